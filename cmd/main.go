@@ -1,16 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"x-clone/internal/config"
 	"x-clone/internal/handler"
 	"x-clone/internal/repository"
 	"x-clone/internal/router"
 	"x-clone/internal/service"
 	"x-clone/pkg/database"
+	"x-clone/pkg/eventbus"
+	"x-clone/pkg/jwtkeys"
 	"x-clone/pkg/logging"
+	"x-clone/pkg/mailer"
+	"x-clone/pkg/metrics"
 	"x-clone/pkg/middleware"
+	"x-clone/pkg/pubsub"
+	"x-clone/pkg/ratelimit"
+	"x-clone/pkg/tracing"
+	"x-clone/pkg/utils/hash"
 
 	"github.com/joho/godotenv"
 )
@@ -25,6 +39,20 @@ func main() {
 	log := logging.Init(cfg.Env)
 	log.WithField("env", cfg.Env).Info("Starting X-clone...")
 
+	if err := hash.Init(cfg); err != nil {
+		log.Fatalf("Failed to initialize password hashing: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+	log.WithField("exporter", cfg.Tracing.Exporter).Debug("Successfully initialized tracing")
+
 	db, err := database.ConnectDB(cfg)
 	if err != nil {
 
@@ -32,34 +60,152 @@ func main() {
 	}
 	log.Debug("Successfully connected to the database")
 
+	if err := metrics.RegisterDB(db, cfg.Database.DBName); err != nil {
+		log.Fatalf("Failed to register database metrics: %v", err)
+	}
+
 	userRepo := repository.NewUserRepository(db)
 	postRepo := repository.NewPostRepository(db)
 	authRepo := repository.NewAuthRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	accountRepo := repository.NewAccountRepository(db)
+	exportRepo := repository.NewExportRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	conversationRepo := repository.NewConversationRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	counterRepo := repository.NewCounterRepository(db)
 	log.Debug("Successfully initialized the repository")
 
-	userService := service.NewUserService(userRepo)
-	postService := service.NewPostService(postRepo, userRepo)
-	authService := service.NewAuthService(authRepo, userRepo, cfg)
+	mail, err := mailer.New(cfg, log)
+	if err != nil {
+		log.Fatalf("Failed to initialize the mailer: %v", err)
+	}
+
+	keys, err := jwtkeys.New(ctx, cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize the jwt signing keys: %v", err)
+	}
+	go keys.Run(ctx, log)
+	log.WithField("algorithm", keys.Algorithm()).Debug("Successfully initialized the jwt signing keys")
+
+	bus := eventbus.New(cfg)
+	go bus.Run(ctx)
+	hub := pubsub.New(cfg)
+
+	jobService := service.NewJobService(jobRepo, cfg)
+	userService := service.NewUserService(userRepo, bus)
+	postService := service.NewPostService(postRepo, userRepo, bus, hub)
+	authService := service.NewAuthService(authRepo, accountRepo, userRepo, mfaRepo, sessionRepo, tokenRepo, keys, mail, cfg)
+	accountService := service.NewAccountService(accountRepo, userRepo, cfg)
+	exportService := service.NewExportService(exportRepo, userRepo, postRepo, jobService, cfg)
+	importService := service.NewImportService(importRepo, userRepo, postRepo, jobService, cfg)
+	messageService := service.NewMessageService(conversationRepo, userRepo, hub, cfg)
+	streamService := service.NewStreamService(bus, authService, cfg)
+	gatewayService := service.NewGatewayService(hub, authService, postRepo, conversationRepo, userRepo, cfg)
+	webhookService := service.NewWebhookService(webhookRepo, userRepo, postRepo, jobService, cfg)
+	outboxService := service.NewOutboxService(outboxRepo, cfg)
+	counterService := service.NewCounterService(counterRepo, cfg)
+	webhookService.Subscribe(outboxService)
+	accountService.RegisterJobs(jobService)
+	exportService.RegisterJobs(jobService)
+	importService.RegisterJobs(jobService)
+	outboxService.RegisterJobs(jobService)
+	webhookService.RegisterJobs(jobService)
+	counterService.RegisterJobs(jobService)
 	log.Debug("Successfully initialized the service")
 
-	authMiddleware := middleware.AuthMiddleware(authService)
+	// cmd/worker runs the outbox relay and the jobs otherwise
+	jobsDone := make(chan struct{})
+	if cfg.Jobs.RunInAPI {
+		go outboxService.RunWorker(ctx, log)
+		go func() {
+			defer close(jobsDone)
+			jobService.RunWorker(ctx, log)
+		}()
+	} else {
+		close(jobsDone)
+	}
+
+	limiter, err := ratelimit.New(cfg, db)
+	if err != nil {
+		log.Fatalf("Failed to initialize the rate limiter: %v", err)
+	}
+
+	middlewares := &router.Middlewares{
+		RealIP:        middleware.RealIP(cfg.Server.TrustProxy),
+		Auth:          middleware.AuthMiddleware(authService),
+		RequestLogger: middleware.RequestLogger(log),
+		RateLimit:     middleware.RateLimiter(limiter),
+	}
 	log.Debug("Successfully initialized middleware")
 
 	userHandler := handler.NewUserHandler(userService)
 	postHandler := handler.NewPostHandler(postService, userService)
 	authHandler := handler.NewAuthHandler(authService)
+	accountHandler := handler.NewAccountHandler(accountService)
+	exportHandler := handler.NewExportHandler(exportService)
+	importHandler := handler.NewImportHandler(importService)
+	messageHandler := handler.NewMessageHandler(messageService)
+	streamHandler := handler.NewStreamHandler(streamService)
+	gatewayHandler := handler.NewGatewayHandler(gatewayService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
 	log.Debug("Successfully initialized the handler")
 
 	handlers := &router.Handlers{
-		AuthHandler: authHandler,
-		PostHandler: postHandler,
-		UserHandler: userHandler,
+		AuthHandler:    authHandler,
+		AccountHandler: accountHandler,
+		ExportHandler:  exportHandler,
+		GatewayHandler: gatewayHandler,
+		ImportHandler:  importHandler,
+		MessageHandler: messageHandler,
+		PostHandler:    postHandler,
+		StreamHandler:  streamHandler,
+		UserHandler:    userHandler,
+		WebhookHandler: webhookHandler,
 	}
-	r := router.New(handlers, authMiddleware)
+	r := router.New(handlers, middlewares)
 	log.Debug("Successfully initialized the router")
 
-	log.Infof("The server is running on address: %s", cfg.Server.Address)
-	if err := http.ListenAndServe(cfg.Server.Address, r); err != nil {
-		log.Fatalf("Failed to start the server: %v", err)
+	srv := &http.Server{
+		Addr:    cfg.Server.Address,
+		Handler: r,
+	}
+	srv.RegisterOnShutdown(bus.Close) // Event streams would otherwise hold Shutdown open
+	srv.RegisterOnShutdown(hub.Close) // Hijacked gateway connections are not closed by Shutdown
+	go func() {
+		log.Infof("The server is running on address: %s", cfg.Server.Address)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start the server: %v", err)
+		}
+	}()
+
+	// Metrics stay off the public listener
+	if cfg.Server.MetricsAddress != "" {
+		metricsSrv := &http.Server{Addr: cfg.Server.MetricsAddress, Handler: metrics.Handler()}
+		go func() {
+			log.Infof("Serving metrics on address: %s", cfg.Server.MetricsAddress)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+		}()
+		defer metricsSrv.Close()
+	}
+
+	<-ctx.Done()
+	log.Info("Shutting down the server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("Failed to shut down the server gracefully: %v", err)
+	}
+	select {
+	case <-jobsDone: // Interrupted jobs are released to run again
+	case <-shutdownCtx.Done():
+		log.Error("Failed to stop the running jobs in time")
 	}
 }
@@ -0,0 +1,129 @@
+// Command worker runs the background jobs and the outbox relay apart from the
+// API, with jobs.run_in_api set to false in the API's configuration.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"x-clone/internal/config"
+	"x-clone/internal/repository"
+	"x-clone/internal/service"
+	"x-clone/pkg/database"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+	"x-clone/pkg/tracing"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit status, so the deferred cleanups run before exiting.
+func run() int {
+	metricsAddress := flag.String("metrics-address", "", "serve Prometheus metrics on this address, e.g. :9091")
+	requeueDead := flag.Bool("requeue-dead", false, "retry the dead jobs and exit")
+	queue := flag.String("queue", "", "with -requeue-dead, only retry the jobs of this queue")
+	reconcileCounters := flag.Bool("reconcile-counters", false, "recompute the like, repost and follow counters and exit")
+	dryRun := flag.Bool("dry-run", false, "with -reconcile-counters, only report the drifted counters")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file: ", err)
+	}
+
+	cfg := config.Load()
+
+	log := logging.Init(cfg.Env)
+	log.WithField("env", cfg.Env).Info("Starting X-clone worker...")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Init(ctx, cfg)
+	if err != nil {
+		log.Errorf("Failed to initialize tracing: %v", err)
+		return 1
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err := database.ConnectDB(cfg)
+	if err != nil {
+		log.Errorf("Failed to connect to the database: %v", err)
+		return 1
+	}
+	if err := metrics.RegisterDB(db, cfg.Database.DBName); err != nil {
+		log.Errorf("Failed to register database metrics: %v", err)
+		return 1
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	postRepo := repository.NewPostRepository(db)
+	accountRepo := repository.NewAccountRepository(db)
+	exportRepo := repository.NewExportRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	jobRepo := repository.NewJobRepository(db)
+	counterRepo := repository.NewCounterRepository(db)
+
+	jobService := service.NewJobService(jobRepo, cfg)
+	accountService := service.NewAccountService(accountRepo, userRepo, cfg)
+	exportService := service.NewExportService(exportRepo, userRepo, postRepo, jobService, cfg)
+	importService := service.NewImportService(importRepo, userRepo, postRepo, jobService, cfg)
+	webhookService := service.NewWebhookService(webhookRepo, userRepo, postRepo, jobService, cfg)
+	outboxService := service.NewOutboxService(outboxRepo, cfg)
+	counterService := service.NewCounterService(counterRepo, cfg)
+	webhookService.Subscribe(outboxService)
+	accountService.RegisterJobs(jobService)
+	exportService.RegisterJobs(jobService)
+	importService.RegisterJobs(jobService)
+	outboxService.RegisterJobs(jobService)
+	webhookService.RegisterJobs(jobService)
+	counterService.RegisterJobs(jobService)
+
+	if *requeueDead {
+		requeued, err := jobService.RequeueDeadJobs(ctx, *queue)
+		if err != nil {
+			log.Errorf("Failed to requeue the dead jobs: %v", err)
+			return 1
+		}
+		log.WithField("jobs", requeued).Info("Requeued the dead jobs")
+		return 0
+	}
+
+	if *reconcileCounters {
+		report, err := counterService.Reconcile(logging.WithEntry(ctx, log.WithField("dry_run", *dryRun)), !*dryRun)
+		if err != nil {
+			log.Errorf("Failed to reconcile the counters: %v", err)
+			return 1
+		}
+		if report.Drifted > 0 && !report.Fixed {
+			return 1
+		}
+		return 0
+	}
+
+	if *metricsAddress != "" {
+		srv := &http.Server{Addr: *metricsAddress, Handler: metrics.Handler()}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	log.Info("The worker is running")
+	go outboxService.RunWorker(ctx, log)
+	jobService.RunWorker(ctx, log)
+	log.Info("The worker stopped")
+	return 0
+}
@@ -8,7 +8,9 @@ import (
 )
 
 type ServerConfig struct {
-	Address string `yaml:"address"`
+	Address        string `yaml:"address"`
+	MetricsAddress string `yaml:"metrics_address"` // Internal listener for Prometheus metrics, empty disables them
+	TrustProxy     bool   `yaml:"trust_proxy"`     // Use X-Forwarded-For/X-Real-IP as client IP
 }
 
 type DatabaseConfig struct {
@@ -21,16 +23,188 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret          string        `env:"JWT_SECRET"`
-	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
-	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	Secret           string        `env:"JWT_SECRET"` // HS256 only
+	Algorithm        string        `yaml:"algorithm"` // HS256, RS256 or EdDSA
+	RotationInterval time.Duration `yaml:"rotation_interval"`
+	RotationOverlap  time.Duration `yaml:"rotation_overlap"` // Retired keys keep verifying, at least access_token_ttl
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"`
+}
+
+type Argon2idConfig struct {
+	Memory      uint32 `yaml:"memory"` // KiB
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+}
+
+type PasswordHashingConfig struct {
+	Algorithm  string         `yaml:"algorithm"` // argon2id or bcrypt, for new hashes
+	BcryptCost int            `yaml:"bcrypt_cost"`
+	Argon2id   Argon2idConfig `yaml:"argon2id"`
+}
+
+type AccountConfig struct {
+	ReactivationWindow time.Duration `yaml:"reactivation_window"` // Deactivated accounts are deleted afterwards
+	DeletionBatchSize  int           `yaml:"deletion_batch_size"`
+}
+
+type ExportConfig struct {
+	Dir         string        `yaml:"dir"`
+	LinkTTL     time.Duration `yaml:"link_ttl"`
+	LimitPeriod time.Duration `yaml:"limit_period"` // One export per period
+}
+
+type ImportConfig struct {
+	Dir     string `yaml:"dir"`
+	MaxSize int64  `yaml:"max_size"` // Upload limit in bytes
+}
+
+type MessagesConfig struct {
+	MaxGroupSize int `yaml:"max_group_size"` // Participants including the creator
+}
+
+type StreamConfig struct {
+	HeartbeatInterval    time.Duration `yaml:"heartbeat_interval"`
+	SubscriberBuffer     int           `yaml:"subscriber_buffer"`      // Undelivered events before a connection is dropped
+	ReplaySize           int           `yaml:"replay_size"`            // Events kept per user for Last-Event-ID
+	ReplayWindow         time.Duration `yaml:"replay_window"`          // How long they are kept after disconnecting
+	MaxConnections       int           `yaml:"max_connections"`        // Per user
+	SessionCheckInterval time.Duration `yaml:"session_check_interval"` // Revoked sessions are disconnected within this
+}
+
+type GatewayConfig struct {
+	OriginPatterns       []string      `yaml:"origin_patterns"` // Allowed cross-origin hosts, same origin and clients without Origin always are
+	ClientBuffer         int           `yaml:"client_buffer"`   // Undelivered events before a connection is dropped
+	MaxConnections       int           `yaml:"max_connections"` // Per user
+	MaxSubscriptions     int           `yaml:"max_subscriptions"`
+	PingInterval         time.Duration `yaml:"ping_interval"`
+	SessionCheckInterval time.Duration `yaml:"session_check_interval"` // Revoked sessions are disconnected within this
+	ReauthWindow         time.Duration `yaml:"reauth_window"`          // auth.expiring is sent this long before the token expires
+	TypingInterval       time.Duration `yaml:"typing_interval"`        // Typing indicators relayed at most once per interval
+}
+
+type JobQueueConfig struct {
+	Concurrency int           `yaml:"concurrency"` // Jobs run at once by each worker process
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxAttempts int           `yaml:"max_attempts"`
+}
+
+type JobsConfig struct {
+	RunInAPI      bool                      `yaml:"run_in_api"` // false when cmd/worker runs the jobs
+	PollInterval  time.Duration             `yaml:"poll_interval"`
+	BaseBackoff   time.Duration             `yaml:"base_backoff"` // Doubled after every failed attempt
+	MaxBackoff    time.Duration             `yaml:"max_backoff"`
+	Retention     time.Duration             `yaml:"retention"`      // Succeeded jobs are kept this long
+	DeadRetention time.Duration             `yaml:"dead_retention"` // Dead jobs are kept this long
+	Queues        map[string]JobQueueConfig `yaml:"queues"`
+	Schedules     map[string]string         `yaml:"schedules"` // Job type to cron expression, in UTC
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`  // Events claimed at once
+	Concurrency  int           `yaml:"concurrency"` // Aggregates dispatched in parallel
+	Lease        time.Duration `yaml:"lease"`       // Claimed events are dispatched again after it if the relay dies
+	MaxAttempts  int           `yaml:"max_attempts"`
+	BaseBackoff  time.Duration `yaml:"base_backoff"` // Doubled after every failed attempt
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+	Retention    time.Duration `yaml:"retention"` // Processed events are kept this long
+}
+
+type WebhooksConfig struct {
+	MaxPerUser           int           `yaml:"max_per_user"`
+	Timeout              time.Duration `yaml:"timeout"`
+	MaxAttempts          int           `yaml:"max_attempts"`
+	BaseBackoff          time.Duration `yaml:"base_backoff"` // Doubled after every failed attempt
+	MaxBackoff           time.Duration `yaml:"max_backoff"`
+	DisableAfter         int           `yaml:"disable_after"` // Consecutive deliveries that failed every attempt
+	Retention            time.Duration `yaml:"retention"`     // Completed deliveries are kept this long
+	AllowPrivateNetworks bool          `yaml:"allow_private_networks"`
+}
+
+type CountersConfig struct {
+	BatchSize  int           `yaml:"batch_size"`  // Posts or users reconciled, and locked when fixing, at once
+	BatchPause time.Duration `yaml:"batch_pause"` // Between batches
+}
+
+type LoginProtectionConfig struct {
+	MaxFailures   int           `yaml:"max_failures"`    // Per account before locking
+	IPMaxFailures int           `yaml:"ip_max_failures"` // Per client IP before locking
+	FailureWindow time.Duration `yaml:"failure_window"`  // Failures older than this are forgotten
+	BaseLockout   time.Duration `yaml:"base_lockout"`    // Doubled on every failure past the limit
+	MaxLockout    time.Duration `yaml:"max_lockout"`
+	EventsLimit   int           `yaml:"events_limit"` // Login events returned to the user
+}
+
+type MFAConfig struct {
+	Issuer        string        `yaml:"issuer"`         // Shown in authenticator apps
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl"`  // Lifetime of the token exchanged for an access token
+	RecoveryCodes int           `yaml:"recovery_codes"` // Issued on confirmation
+}
+
+type MailConfig struct {
+	Driver       string `yaml:"driver"` // log, file or smtp
+	From         string `yaml:"from"`
+	FileDir      string `yaml:"file_dir"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	URL      string        `yaml:"url"` // %s is replaced with the token
+}
+
+type EmailVerificationConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	URL      string        `yaml:"url"` // %s is replaced with the token
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"` // none, stdout or otlp
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	Insecure     bool    `yaml:"insecure"`
+	ServiceName  string  `yaml:"service_name"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"` // Defaults to requests
+}
+
+type RateLimitConfig struct {
+	Enabled  bool                       `yaml:"enabled"`
+	Backend  string                     `yaml:"backend"` // memory or postgres
+	Policies map[string]RateLimitPolicy `yaml:"policies"`
 }
 
 type Config struct {
-	Env      string         `env:"APP_ENV"`
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	JWT      JWTConfig      `yaml:"jwt"`
+	Env               string                  `env:"APP_ENV"`
+	Server            ServerConfig            `yaml:"server"`
+	Database          DatabaseConfig          `yaml:"database"`
+	JWT               JWTConfig               `yaml:"jwt"`
+	PasswordHashing   PasswordHashingConfig   `yaml:"password_hashing"`
+	Account           AccountConfig           `yaml:"account"`
+	Export            ExportConfig            `yaml:"export"`
+	Import            ImportConfig            `yaml:"import"`
+	Messages          MessagesConfig          `yaml:"messages"`
+	Stream            StreamConfig            `yaml:"stream"`
+	Gateway           GatewayConfig           `yaml:"gateway"`
+	Jobs              JobsConfig              `yaml:"jobs"`
+	Outbox            OutboxConfig            `yaml:"outbox"`
+	Webhooks          WebhooksConfig          `yaml:"webhooks"`
+	Counters          CountersConfig          `yaml:"counters"`
+	LoginProtection   LoginProtectionConfig   `yaml:"login_protection"`
+	MFA               MFAConfig               `yaml:"mfa"`
+	Mail              MailConfig              `yaml:"mail"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	Tracing           TracingConfig           `yaml:"tracing"`
+	RateLimit         RateLimitConfig         `yaml:"rate_limit"`
 }
 
 func Load() *Config {
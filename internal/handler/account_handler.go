@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"x-clone/internal/service"
+	"x-clone/internal/validator"
+	"x-clone/pkg/middleware"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+func (h *AccountHandler) Deactivate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.PasswordConfirmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.accountService.Deactivate(r.Context(), userID, req.Password); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *AccountHandler) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.PasswordConfirmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.accountService.Delete(r.Context(), userID, req.Password); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -2,10 +2,17 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 	"x-clone/internal/model"
 	"x-clone/internal/service"
 	"x-clone/internal/validator"
+	"x-clone/pkg/jwtkeys"
+	"x-clone/pkg/middleware"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type AuthHandler struct {
@@ -21,19 +28,20 @@ func (h *AuthHandler) Register() http.HandlerFunc {
 		// Req parsing
 		var req validator.RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
 		// To model
 		user := model.User{
 			Username:  req.Username,
+			Email:     &req.Email,
 			Password:  req.Password,
 			FirstName: req.FirstName,
 			LastName:  req.LastName,
@@ -42,9 +50,13 @@ func (h *AuthHandler) Register() http.HandlerFunc {
 		}
 
 		// Service call
-		token, err := h.authService.Register(&user)
+		client := service.ClientInfo{
+			IP:        middleware.GetClientIP(r.Context()),
+			UserAgent: r.UserAgent(),
+		}
+		token, err := h.authService.Register(r.Context(), &user, client)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 
@@ -62,28 +74,496 @@ func (h *AuthHandler) Login() http.HandlerFunc {
 		// Req parsing
 		var req validator.LoginRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		client := service.ClientInfo{
+			IP:        middleware.GetClientIP(r.Context()),
+			UserAgent: r.UserAgent(),
+		}
+		result, err := h.authService.Login(r.Context(), req.Username, req.Password, client)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		writeLoginResult(w, result)
+	}
+}
+
+func (h *AuthHandler) LoginMFA() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Req parsing
+		var req validator.MFALoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		client := service.ClientInfo{
+			IP:        middleware.GetClientIP(r.Context()),
+			UserAgent: r.UserAgent(),
+		}
+		result, err := h.authService.VerifyMFALogin(r.Context(), req.MFAToken, req.Code, client)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		writeLoginResult(w, result)
+	}
+}
+
+func writeLoginResult(w http.ResponseWriter, result *service.LoginResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if result.MFAToken != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": result.AccessToken,
+	})
+}
+
+func (h *AuthHandler) GetLoginEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
 			return
 		}
 
 		// Service call
-		token, err := h.authService.Login(req.Username, req.Password)
+		events, err := h.authService.GetLoginEvents(r.Context(), userID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			writeError(w, r, err)
 			return
 		}
 
 		// Response
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+func (h *AuthHandler) EnrollTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		enrollment, err := h.authService.EnrollTOTP(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(enrollment)
+	}
+}
+
+func (h *AuthHandler) ConfirmTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		recoveryCodes, err := h.authService.ConfirmTOTP(r.Context(), userID, req.Code)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":        "two-factor authentication enabled",
+			"recovery_codes": recoveryCodes,
+		})
+	}
+}
+
+func (h *AuthHandler) DisableTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.MFACodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.authService.DisableTOTP(r.Context(), userID, req.Code); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *AuthHandler) ForgotPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Req parsing
+		var req validator.ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		h.authService.ForgotPassword(r.Context(), req.Email)
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
 		json.NewEncoder(w).Encode(map[string]string{
-			"access_token": token,
+			"message": "if the email belongs to an account, a reset link has been sent",
 		})
 	}
 }
+
+func (h *AuthHandler) ResetPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Req parsing
+		var req validator.ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.authService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "successfully reset password",
+		})
+	}
+}
+
+func (h *AuthHandler) VerifyEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Req parsing
+		var req validator.VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.authService.VerifyEmail(r.Context(), req.Token); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *AuthHandler) ResendEmailVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		if err := h.authService.ResendEmailVerification(r.Context(), userID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (h *AuthHandler) ChangeEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.EmailChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		if err := h.authService.ChangeEmail(r.Context(), userID, req.Email); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (h *AuthHandler) GetSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+		sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+		// Service call
+		sessions, err := h.authService.GetSessions(r.Context(), userID, sessionID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+func (h *AuthHandler) RevokeSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		if err := h.authService.RevokeSession(r.Context(), userID, chi.URLParam(r, "session_id")); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *AuthHandler) RevokeOtherSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+		sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+		// Service call
+		if err := h.authService.RevokeOtherSessions(r.Context(), userID, sessionID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *AuthHandler) JWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwtkeys.JWKSMaxAge.Seconds())))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(h.authService.JWKS())
+	}
+}
+
+func (h *AuthHandler) CreatePersonalAccessToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.PersonalAccessTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		var expiresIn time.Duration
+		if req.ExpiresInDays != nil {
+			expiresIn = time.Duration(*req.ExpiresInDays) * 24 * time.Hour
+		}
+		token, pat, err := h.authService.CreatePersonalAccessToken(r.Context(), userID, req.Name, req.Scopes, expiresIn)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			Token string `json:"token"`
+			*model.PersonalAccessToken
+		}{token, pat})
+	}
+}
+
+func (h *AuthHandler) GetPersonalAccessTokens() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		tokens, err := h.authService.GetPersonalAccessTokens(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+func (h *AuthHandler) RevokePersonalAccessToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		tokenID, err := strconv.Atoi(chi.URLParam(r, "token_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_token_id", "invalid token_id")
+			return
+		}
+
+		// Service call
+		if err := h.authService.RevokePersonalAccessToken(r.Context(), userID, tokenID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"x-clone/internal/service"
+	"x-clone/internal/validator"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/problem"
+)
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusFromError(err)
+	if status == http.StatusInternalServerError {
+		logging.FromContext(r.Context()).WithError(err).Error("request failed")
+		problem.Error(w, r, status, "internal_error", "internal server error")
+		return
+	}
+
+	code := "error"
+	var codedErr interface{ Code() string }
+	if errors.As(err, &codedErr) {
+		code = codedErr.Code()
+	}
+
+	var lockedErr *service.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+	}
+
+	problem.Error(w, r, status, code, err.Error())
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problem.New(http.StatusUnprocessableEntity, "validation_failed", "request validation failed")
+	p.Errors = validator.FieldErrors(err)
+	problem.Write(w, r, p)
+}
+
+func writeBadRequest(w http.ResponseWriter, r *http.Request, code, detail string) {
+	problem.Error(w, r, http.StatusBadRequest, code, detail)
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, http.StatusUnauthorized, "unauthorized", "unauthorized")
+}
+
+func statusFromError(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrTooMany):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"x-clone/internal/model"
+	"x-clone/internal/service"
+	"x-clone/pkg/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+}
+
+func NewExportHandler(exportService *service.ExportService) *ExportHandler {
+	return &ExportHandler{exportService: exportService}
+}
+
+type exportResponse struct {
+	*model.DataExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+func newExportResponse(export *model.DataExport) exportResponse {
+	resp := exportResponse{DataExport: export}
+	if export.Status == model.ExportCompleted {
+		resp.DownloadURL = fmt.Sprintf("/settings/export/%d/download", export.DataExportID)
+	}
+	return resp
+}
+
+func (h *ExportHandler) RequestExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		export, err := h.exportService.RequestExport(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/settings/export/%d", export.DataExportID))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newExportResponse(export))
+	}
+}
+
+func (h *ExportHandler) GetExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		exportID, err := strconv.Atoi(chi.URLParam(r, "export_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_export_id", "invalid export_id")
+			return
+		}
+
+		// Service call
+		export, err := h.exportService.GetExport(r.Context(), userID, exportID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(newExportResponse(export))
+	}
+}
+
+func (h *ExportHandler) DownloadExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		exportID, err := strconv.Atoi(chi.URLParam(r, "export_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_export_id", "invalid export_id")
+			return
+		}
+
+		// Service call
+		file, export, err := h.exportService.OpenExport(r.Context(), userID, exportID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		// Response
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", service.ArchiveName(export)))
+		http.ServeContent(w, r, "", *export.CompletedAt, file)
+	}
+}
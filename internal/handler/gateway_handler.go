@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/service"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/pubsub"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	gatewayReadLimit    = 16 << 10 // Client frames are small
+	gatewayWriteTimeout = 10 * time.Second
+
+	// Closing code when the token expired or the session was revoked, the
+	// client should log in again before reconnecting
+	closeUnauthorized websocket.StatusCode = 4001
+)
+
+// gatewayFrame is a message from the client.
+type gatewayFrame struct {
+	Type    string `json:"type"` // subscribe, unsubscribe, typing or auth
+	Channel string `json:"channel"`
+	Token   string `json:"token"` // auth only
+}
+
+type errorEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type authEvent struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type GatewayHandler struct {
+	gatewayService *service.GatewayService
+}
+
+func NewGatewayHandler(gatewayService *service.GatewayService) *GatewayHandler {
+	return &GatewayHandler{gatewayService: gatewayService}
+}
+
+func (h *GatewayHandler) Connect() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("access_token") // Browsers cannot set headers on WebSocket requests
+		}
+		session, err := h.gatewayService.Authenticate(r.Context(), token)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Service call
+		client, err := h.gatewayService.Connect(r.Context(), session.UserID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer h.gatewayService.Disconnect(client)
+
+		// Response
+		settings := h.gatewayService.Settings()
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: settings.OriginPatterns})
+		if err != nil {
+			return // Accept responded already
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(gatewayReadLimit)
+
+		c := &gatewayConn{
+			service:    h.gatewayService,
+			settings:   settings,
+			conn:       conn,
+			client:     client,
+			session:    session,
+			lastTyping: make(map[string]time.Time),
+		}
+		c.serve(r.Context())
+	}
+}
+
+// gatewayConn is the state of one gateway connection, owned by serve.
+type gatewayConn struct {
+	service    *service.GatewayService
+	settings   config.GatewayConfig
+	conn       *websocket.Conn
+	client     *pubsub.Client
+	session    *service.GatewaySession
+	lastTyping map[string]time.Time // By channel
+}
+
+func (c *gatewayConn) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	frames := make(chan []byte)
+	go c.read(ctx, cancel, frames)
+	go c.ping(ctx, cancel)
+
+	sessionCheck := time.NewTicker(c.settings.SessionCheckInterval)
+	defer sessionCheck.Stop()
+	expiry := time.NewTimer(c.untilExpiring())
+	defer expiry.Stop()
+	expiring := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case data := <-frames:
+			if c.handle(ctx, data) {
+				expiring = false
+				expiry.Reset(c.untilExpiring())
+			}
+		case frame, ok := <-c.client.C:
+			if !ok {
+				if c.client.Lagged() {
+					c.conn.Close(websocket.StatusTryAgainLater, "too slow")
+				} else {
+					c.conn.Close(websocket.StatusGoingAway, "server shutting down")
+				}
+				return
+			}
+			if err := c.write(ctx, frame); err != nil {
+				return
+			}
+		case <-sessionCheck.C:
+			if err := c.service.Reauthenticate(ctx, c.session, ""); err != nil {
+				if errors.Is(err, service.ErrInvalidToken) {
+					c.conn.Close(closeUnauthorized, "session revoked")
+					return
+				}
+				logging.FromContext(ctx).WithError(err).Warn("failed to check gateway session")
+			}
+		case <-expiry.C:
+			if expiring {
+				c.conn.Close(closeUnauthorized, "token expired")
+				return
+			}
+			expiring = true
+			c.send(ctx, pubsub.Event{Type: service.EventAuthExpiring, Data: authEvent{ExpiresAt: c.session.ExpiresAt}})
+			expiry.Reset(time.Until(c.session.ExpiresAt))
+		}
+	}
+}
+
+// read forwards client frames until the connection fails or closes.
+func (c *gatewayConn) read(ctx context.Context, cancel context.CancelFunc, frames chan<- []byte) {
+	defer cancel()
+	for {
+		_, data, err := c.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		select {
+		case frames <- data:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ping detects dead connections that never closed.
+func (c *gatewayConn) ping(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(c.settings.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, c.settings.PingInterval)
+			err := c.conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// handle processes a client frame, it reports whether the client authenticated again.
+func (c *gatewayConn) handle(ctx context.Context, data []byte) bool {
+	var frame gatewayFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		c.send(ctx, pubsub.Event{Type: service.EventError, Data: errorEvent{Code: "invalid_json", Message: "invalid json"}})
+		return false
+	}
+
+	var err error
+	switch frame.Type {
+	case "subscribe":
+		if err = c.service.Subscribe(ctx, c.session.UserID, c.client, frame.Channel); err == nil {
+			c.send(ctx, pubsub.Event{Type: service.EventSubscribed, Channel: frame.Channel})
+		}
+	case "unsubscribe":
+		if err = c.service.Unsubscribe(c.session.UserID, c.client, frame.Channel); err == nil {
+			c.send(ctx, pubsub.Event{Type: service.EventUnsubscribed, Channel: frame.Channel})
+		}
+	case "typing":
+		if time.Since(c.lastTyping[frame.Channel]) < c.settings.TypingInterval {
+			return false // Throttled
+		}
+		if err = c.service.Typing(ctx, c.session.UserID, c.client, frame.Channel); err == nil {
+			c.lastTyping[frame.Channel] = time.Now()
+		}
+	case "auth":
+		if err = c.service.Reauthenticate(ctx, c.session, frame.Token); err == nil {
+			c.send(ctx, pubsub.Event{Type: service.EventAuthenticated, Data: authEvent{ExpiresAt: c.session.ExpiresAt}})
+			return true
+		}
+	default:
+		c.send(ctx, pubsub.Event{Type: service.EventError, Data: errorEvent{Code: "unknown_type", Message: "unknown message type"}})
+		return false
+	}
+
+	if err != nil {
+		c.sendError(ctx, frame.Channel, err)
+	}
+	return false
+}
+
+func (c *gatewayConn) sendError(ctx context.Context, channel string, err error) {
+	event := errorEvent{Code: "internal_error", Message: "internal server error"}
+	if statusFromError(err) == http.StatusInternalServerError {
+		logging.FromContext(ctx).WithError(err).Error("gateway request failed")
+	} else {
+		var codedErr interface{ Code() string }
+		if errors.As(err, &codedErr) {
+			event = errorEvent{Code: codedErr.Code(), Message: err.Error()}
+		}
+	}
+	c.send(ctx, pubsub.Event{Type: service.EventError, Channel: channel, Data: event})
+}
+
+// send writes a reply, a failed write ends the connection through read.
+func (c *gatewayConn) send(ctx context.Context, event pubsub.Event) {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Error("failed to encode gateway event")
+		return
+	}
+	c.write(ctx, frame)
+}
+
+func (c *gatewayConn) write(ctx context.Context, frame []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, gatewayWriteTimeout)
+	defer cancel()
+	return c.conn.Write(ctx, websocket.MessageText, frame)
+}
+
+// untilExpiring is the time left until the client is asked for a fresh token.
+func (c *gatewayConn) untilExpiring() time.Duration {
+	return max(time.Until(c.session.ExpiresAt.Add(-c.settings.ReauthWindow)), 0)
+}
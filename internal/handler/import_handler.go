@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"x-clone/internal/service"
+	"x-clone/pkg/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ImportHandler struct {
+	importService *service.ImportService
+}
+
+func NewImportHandler(importService *service.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+func (h *ImportHandler) RequestImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		archive, err := importArchive(r)
+		if err != nil {
+			writeBadRequest(w, r, "invalid_upload", "expected the archive as the request body or a multipart file field")
+			return
+		}
+
+		// Service call
+		dataImport, err := h.importService.RequestImport(r.Context(), userID, archive)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/settings/import/%d", dataImport.DataImportID))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(dataImport)
+	}
+}
+
+// importArchive streams the "file" field of a multipart form, or the raw body.
+func importArchive(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+func (h *ImportHandler) GetImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		importID, err := strconv.Atoi(chi.URLParam(r, "import_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_import_id", "invalid import_id")
+			return
+		}
+
+		// Service call
+		dataImport, err := h.importService.GetImport(r.Context(), userID, importID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(dataImport)
+	}
+}
@@ -0,0 +1,472 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"x-clone/internal/service"
+	"x-clone/internal/validator"
+	"x-clone/pkg/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type MessageHandler struct {
+	messageService *service.MessageService
+}
+
+func NewMessageHandler(messageService *service.MessageService) *MessageHandler {
+	return &MessageHandler{messageService: messageService}
+}
+
+func (h *MessageHandler) SendDirectMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.DirectMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		message, err := h.messageService.SendDirectMessage(r.Context(), userID, req.Username, req.Content)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+func (h *MessageHandler) GetConversations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		cursor, limit, ok := pageQuery(r)
+		if !ok {
+			writeBadRequest(w, r, "invalid_limit", "limit must be between 1 and 100")
+			return
+		}
+
+		// Service call
+		conversations, next, err := h.messageService.GetConversations(r.Context(), userID, cursor, limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"conversations": conversations,
+			"next_cursor":   next,
+		})
+	}
+}
+
+func (h *MessageHandler) GetConversation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+
+		// Service call
+		conversation, err := h.messageService.GetConversation(r.Context(), userID, conversationID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func (h *MessageHandler) GetMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		cursor, limit, ok := pageQuery(r)
+		if !ok {
+			writeBadRequest(w, r, "invalid_limit", "limit must be between 1 and 100")
+			return
+		}
+
+		// Service call
+		messages, next, err := h.messageService.GetMessages(r.Context(), userID, conversationID, cursor, limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages":    messages,
+			"next_cursor": next,
+		})
+	}
+}
+
+func (h *MessageHandler) SendMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		var req validator.ContentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		message, err := h.messageService.SendMessage(r.Context(), userID, conversationID, req.Content)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
+
+func (h *MessageHandler) MarkConversationRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+
+		// Service call
+		if err := h.messageService.MarkConversationRead(r.Context(), userID, conversationID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *MessageHandler) DeleteMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		messageID, err := strconv.Atoi(chi.URLParam(r, "message_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_message_id", "invalid message_id")
+			return
+		}
+
+		// Service call
+		if err := h.messageService.DeleteMessage(r.Context(), userID, conversationID, messageID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *MessageHandler) CreateGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.GroupCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		conversation, err := h.messageService.CreateGroup(r.Context(), userID, req.Name, req.Usernames)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func (h *MessageHandler) RenameConversation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		var req validator.ConversationRenameRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		conversation, err := h.messageService.RenameConversation(r.Context(), userID, conversationID, req.Name)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func (h *MessageHandler) AddParticipants() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		var req validator.ParticipantsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		conversation, err := h.messageService.AddParticipants(r.Context(), userID, conversationID, req.Usernames)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func (h *MessageHandler) SetParticipantRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		username := chi.URLParam(r, "username")
+		var req validator.ParticipantRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		conversation, err := h.messageService.SetParticipantRole(r.Context(), userID, conversationID, username, req.Role)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func (h *MessageHandler) RemoveParticipant() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+		username := chi.URLParam(r, "username")
+
+		// Service call
+		if err := h.messageService.RemoveParticipant(r.Context(), userID, conversationID, username); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *MessageHandler) LeaveConversation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		conversationID, err := strconv.Atoi(chi.URLParam(r, "conversation_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_conversation_id", "invalid conversation_id")
+			return
+		}
+
+		// Service call
+		if err := h.messageService.LeaveConversation(r.Context(), userID, conversationID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageQuery reads the ?cursor= and ?limit= query parameters of paginated lists.
+func pageQuery(r *http.Request) (string, int, bool) {
+	limit := defaultPageLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return "", 0, false
+		}
+		limit = n
+	}
+	return r.URL.Query().Get("cursor"), limit, true
+}
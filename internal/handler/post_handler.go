@@ -26,20 +26,20 @@ func (h *PostHandler) CreatePost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
 		// Req parsing
 		var req validator.ContentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
@@ -50,9 +50,9 @@ func (h *PostHandler) CreatePost() http.HandlerFunc {
 		}
 
 		// Service call
-		newPost, err := h.postService.CreatePost(&post)
+		newPost, err := h.postService.CreatePost(r.Context(), &post)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 
@@ -69,14 +69,14 @@ func (h *PostHandler) GetUserPosts() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		posts, err := h.postService.GetUserPosts(user.UserID)
+		posts, err := h.postService.GetUserPosts(r.Context(), user.UserID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -93,19 +93,19 @@ func (h *PostHandler) GetUserPostByID() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(user.UserID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -121,7 +121,7 @@ func (h *PostHandler) UpdatePostContentByID() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -129,41 +129,41 @@ func (h *PostHandler) UpdatePostContentByID() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Req parsing
 		var req validator.ContentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 		if user.UserID != userID {
-			http.Error(w, "you are not owner of this post", http.StatusForbidden)
+			writeError(w, r, service.ErrNotPostOwner)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(userID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), userID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		updatedPost, err := h.postService.UpdatePostContentByID(userID, post.PostID, req.Content)
+		updatedPost, err := h.postService.UpdatePostContentByID(r.Context(), userID, post.PostID, req.Content)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -179,7 +179,7 @@ func (h *PostHandler) DeletePostByID() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -187,27 +187,27 @@ func (h *PostHandler) DeletePostByID() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 		if user.UserID != userID {
-			http.Error(w, "you are not owner of this post", http.StatusForbidden)
+			writeError(w, r, service.ErrNotPostOwner)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(userID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), userID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.postService.DeletePostByID(userID, post.PostID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := h.postService.DeletePostByID(r.Context(), userID, post.PostID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -225,7 +225,7 @@ func (h *PostHandler) LikePost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -233,23 +233,23 @@ func (h *PostHandler) LikePost() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(user.UserID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.postService.LikePost(userID, post.PostID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := h.postService.LikePost(r.Context(), userID, post.PostID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -268,7 +268,7 @@ func (h *PostHandler) UnlikePost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -276,33 +276,28 @@ func (h *PostHandler) UnlikePost() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(user.UserID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.postService.UnlikePost(userID, post.PostID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := h.postService.UnlikePost(r.Context(), userID, post.PostID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
 		// Response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "successfully unliked the post",
-			"post_id": postID,
-		})
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -311,7 +306,7 @@ func (h *PostHandler) RepostPost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -319,23 +314,23 @@ func (h *PostHandler) RepostPost() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(user.UserID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.postService.RepostPost(userID, post.PostID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := h.postService.RepostPost(r.Context(), userID, post.PostID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -354,7 +349,7 @@ func (h *PostHandler) UndoRepostPost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -362,33 +357,28 @@ func (h *PostHandler) UndoRepostPost() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		post, err := h.postService.GetUserPostByID(user.UserID, postID)
+		post, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.postService.UndoRepostPost(userID, post.PostID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := h.postService.UndoRepostPost(r.Context(), userID, post.PostID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
 		// Response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "successfully cancelled repost of the post",
-			"post_id": postID,
-		})
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -398,14 +388,14 @@ func (h *PostHandler) GetUserReposts() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		posts, err := h.postService.GetUserReposts(user.UserID)
+		posts, err := h.postService.GetUserReposts(r.Context(), user.UserID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -421,7 +411,7 @@ func (h *PostHandler) QuotePost() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -429,37 +419,37 @@ func (h *PostHandler) QuotePost() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 		postID, err := strconv.Atoi(chi.URLParam(r, "post_id"))
 		if err != nil {
-			http.Error(w, "invalid post_id", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_post_id", "invalid post_id")
 			return
 		}
 
 		// Req parsing
 		var req validator.ContentRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		originalPost, err := h.postService.GetUserPostByID(user.UserID, postID)
+		originalPost, err := h.postService.GetUserPostByID(r.Context(), user.UserID, postID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		quotePost, err := h.postService.QuotePost(userID, originalPost.PostID, req.Content)
+		quotePost, err := h.postService.QuotePost(r.Context(), userID, originalPost.PostID, req.Content)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"x-clone/internal/service"
+	"x-clone/pkg/eventbus"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/middleware"
+	"x-clone/pkg/problem"
+)
+
+const (
+	streamResetEvent        = "stream.reset"        // Sent instead of the missed events when they can no longer be replayed
+	streamUnauthorizedEvent = "stream.unauthorized" // Sent before closing a stream whose session was revoked or token expired
+)
+
+type StreamHandler struct {
+	streamService *service.StreamService
+}
+
+func NewStreamHandler(streamService *service.StreamService) *StreamHandler {
+	return &StreamHandler{streamService: streamService}
+}
+
+func (h *StreamHandler) Stream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expiresAt, err := h.streamService.CheckSession(r.Context(), token)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Req parsing
+		lastEventID := r.Header.Get("Last-Event-ID")
+
+		// Service call
+		sub, replay, resumed, err := h.streamService.Subscribe(r.Context(), userID, lastEventID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer h.streamService.Unsubscribe(sub)
+
+		// Response
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, "streaming_unsupported", "streaming unsupported")
+			return
+		}
+
+		if !resumed {
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamResetEvent)
+		}
+		for _, event := range replay {
+			writeEvent(w, event)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(h.streamService.HeartbeatInterval())
+		defer heartbeat.Stop()
+		sessionCheck := time.NewTicker(h.streamService.SessionCheckInterval())
+		defer sessionCheck.Stop()
+		expiry := time.NewTimer(time.Until(expiresAt))
+		defer expiry.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case <-sessionCheck.C:
+				if _, err := h.streamService.CheckSession(r.Context(), token); err != nil {
+					if errors.Is(err, service.ErrInvalidToken) {
+						writeUnauthorizedEvent(w, rc)
+						return
+					}
+					logging.FromContext(r.Context()).WithError(err).Warn("failed to check stream session")
+				}
+			case <-expiry.C:
+				writeUnauthorizedEvent(w, rc)
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					if sub.Lagged() {
+						logging.FromContext(r.Context()).Warn("event stream dropped a slow consumer")
+					}
+					return // The client reconnects with Last-Event-ID
+				}
+				writeEvent(w, event)
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event eventbus.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
+// writeUnauthorizedEvent tells the client to authenticate again before reconnecting.
+func writeUnauthorizedEvent(w http.ResponseWriter, rc *http.ResponseController) {
+	fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamUnauthorizedEvent)
+	rc.Flush()
+}
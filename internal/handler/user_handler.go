@@ -24,9 +24,9 @@ func (h *UserHandler) GetUserByUsername() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
 
@@ -42,7 +42,7 @@ func (h *UserHandler) FollowUser() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -50,13 +50,13 @@ func (h *UserHandler) FollowUser() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.userService.FollowUser(userID, user.UserID); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := h.userService.FollowUser(r.Context(), userID, user.UserID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -75,7 +75,7 @@ func (h *UserHandler) StopFollowingUser() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
@@ -83,13 +83,41 @@ func (h *UserHandler) StopFollowingUser() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		if err := h.userService.StopFollowingUser(userID, user.UserID); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := h.userService.StopFollowingUser(r.Context(), userID, user.UserID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *UserHandler) BlockUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// URL parsing
+		username := chi.URLParam(r, "username")
+
+		// Service call
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := h.userService.BlockUser(r.Context(), userID, user.UserID); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -97,26 +125,54 @@ func (h *UserHandler) StopFollowingUser() http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message":  "successfully stop following the user",
+			"message":  "successfully blocked the user",
 			"username": username,
 		})
 	}
 }
 
+func (h *UserHandler) UnblockUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// URL parsing
+		username := chi.URLParam(r, "username")
+
+		// Service call
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if err := h.userService.UnblockUser(r.Context(), userID, user.UserID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func (h *UserHandler) GetFollowersByUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// URL parsing
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		followers, err := h.userService.GetFollowersByUser(user.UserID)
+		followers, err := h.userService.GetFollowersByUser(r.Context(), user.UserID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -133,14 +189,14 @@ func (h *UserHandler) GetFollowingByUser() http.HandlerFunc {
 		username := chi.URLParam(r, "username")
 
 		// Service call
-		user, err := h.userService.GetUserByUsername(username)
+		user, err := h.userService.GetUserByUsername(r.Context(), username)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, r, err)
 			return
 		}
-		following, err := h.userService.GetFollowingByUser(user.UserID)
+		following, err := h.userService.GetFollowingByUser(r.Context(), user.UserID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -156,20 +212,20 @@ func (h *UserHandler) ProfileUpdate() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
 		// Req parsing
 		var req validator.ProfileUpdateRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
@@ -190,11 +246,14 @@ func (h *UserHandler) ProfileUpdate() http.HandlerFunc {
 		if req.Bio != nil {
 			updates["bio"] = *req.Bio
 		}
+		if req.DMPermission != nil {
+			updates["dm_permission"] = *req.DMPermission
+		}
 
 		// Service call
-		user, err := h.userService.ProfileUpdate(userID, updates)
+		user, err := h.userService.ProfileUpdate(r.Context(), userID, updates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -210,26 +269,27 @@ func (h *UserHandler) PasswordChange() http.HandlerFunc {
 		// Authentication
 		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
 		if !ok {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeUnauthorized(w, r)
 			return
 		}
 
 		// Req parsing
 		var req validator.PasswordChangeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+			writeBadRequest(w, r, "invalid_json", "invalid json")
 			return
 		}
 
 		// Validation
 		if err := validator.Validate(req); err != nil {
-			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			writeValidationError(w, r, err)
 			return
 		}
 
 		// Service call
-		if err := h.userService.PasswordChange(userID, req.OldPassword, req.NewPassword); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+		if err := h.userService.PasswordChange(r.Context(), userID, sessionID, req.OldPassword, req.NewPassword, req.RevokeOtherSessions); err != nil {
+			writeError(w, r, err)
 			return
 		}
 
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"x-clone/internal/model"
+	"x-clone/internal/service"
+	"x-clone/internal/validator"
+	"x-clone/pkg/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+func (h *WebhookHandler) CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		var req validator.WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		secret, webhook, err := h.webhookService.CreateWebhook(r.Context(), userID, req.URL, req.Events)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/settings/webhooks/%d", webhook.WebhookID))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			Secret string `json:"secret"`
+			*model.Webhook
+		}{secret, webhook})
+	}
+}
+
+func (h *WebhookHandler) GetWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Service call
+		webhooks, err := h.webhookService.GetWebhooks(r.Context(), userID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(webhooks)
+	}
+}
+
+func (h *WebhookHandler) GetWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		webhookID, err := strconv.Atoi(chi.URLParam(r, "webhook_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_webhook_id", "invalid webhook_id")
+			return
+		}
+
+		// Service call
+		webhook, err := h.webhookService.GetWebhook(r.Context(), userID, webhookID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(webhook)
+	}
+}
+
+func (h *WebhookHandler) UpdateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		webhookID, err := strconv.Atoi(chi.URLParam(r, "webhook_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_webhook_id", "invalid webhook_id")
+			return
+		}
+		var req validator.WebhookUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, "invalid_json", "invalid json")
+			return
+		}
+
+		// Validation
+		if err := validator.Validate(req); err != nil {
+			writeValidationError(w, r, err)
+			return
+		}
+
+		// Service call
+		webhook, err := h.webhookService.UpdateWebhook(r.Context(), userID, webhookID, req.URL, req.Events, req.Active)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(webhook)
+	}
+}
+
+func (h *WebhookHandler) DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		webhookID, err := strconv.Atoi(chi.URLParam(r, "webhook_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_webhook_id", "invalid webhook_id")
+			return
+		}
+
+		// Service call
+		if err := h.webhookService.DeleteWebhook(r.Context(), userID, webhookID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *WebhookHandler) PingWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		webhookID, err := strconv.Atoi(chi.URLParam(r, "webhook_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_webhook_id", "invalid webhook_id")
+			return
+		}
+
+		// Service call
+		delivery, err := h.webhookService.PingWebhook(r.Context(), userID, webhookID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(delivery)
+	}
+}
+
+func (h *WebhookHandler) GetDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Authentication
+		userID, ok := r.Context().Value(middleware.UserIDKey).(int)
+		if !ok {
+			writeUnauthorized(w, r)
+			return
+		}
+
+		// Req parsing
+		webhookID, err := strconv.Atoi(chi.URLParam(r, "webhook_id"))
+		if err != nil {
+			writeBadRequest(w, r, "invalid_webhook_id", "invalid webhook_id")
+			return
+		}
+		cursor, limit, ok := pageQuery(r)
+		if !ok {
+			writeBadRequest(w, r, "invalid_limit", "limit must be between 1 and 100")
+			return
+		}
+
+		// Service call
+		deliveries, next, err := h.webhookService.GetDeliveries(r.Context(), userID, webhookID, cursor, limit)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		// Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"deliveries":  deliveries,
+			"next_cursor": next,
+		})
+	}
+}
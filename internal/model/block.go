@@ -0,0 +1,12 @@
+package model
+
+import (
+	"time"
+)
+
+// Block stops DMs and follows between two users in both directions.
+type Block struct {
+	BlockerID int       `gorm:"primaryKey"`
+	BlockedID int       `gorm:"primaryKey;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
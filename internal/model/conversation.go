@@ -0,0 +1,75 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	DMPermissionEveryone  = "everyone"
+	DMPermissionFollowing = "following" // Only users the recipient follows
+
+	ConversationDirect = "direct"
+	ConversationGroup  = "group"
+
+	ParticipantMember = "member"
+	ParticipantAdmin  = "admin" // Manages group members and roles
+
+	MessageText   = "text"
+	MessageSystem = "system" // Membership and name changes, sent by the acting user
+)
+
+type Conversation struct {
+	ConversationID int       `json:"conversation_id" gorm:"primaryKey;autoIncrement"`
+	Kind           string    `json:"kind" gorm:"size:16;not null;default:direct"`
+	Name           *string   `json:"name" gorm:"size:64;default:null"`          // Groups only
+	DirectKey      *string   `json:"-" gorm:"size:32;uniqueIndex;default:null"` // "<lower user ID>:<higher user ID>", one conversation per pair
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+	LastMessageID  *int      `json:"-" gorm:"default:null"`
+	LastMessageAt  time.Time `json:"last_message_at" gorm:"index"`
+
+	Participants []ConversationParticipant `json:"-" gorm:"foreignKey:ConversationID"`
+}
+
+type ConversationParticipant struct {
+	ConversationID    int       `gorm:"primaryKey"`
+	UserID            int       `gorm:"primaryKey;index"`
+	Role              string    `gorm:"size:16;not null;default:member"`
+	LastReadMessageID int       `gorm:"not null;default:0"` // Read receipt, everything up to it was read
+	JoinedAt          time.Time `gorm:"autoCreateTime"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+type Message struct {
+	MessageID      int       `json:"message_id" gorm:"primaryKey;autoIncrement"`
+	ConversationID int       `json:"conversation_id" gorm:"index;not null"`
+	Kind           string    `json:"kind" gorm:"size:16;not null;default:text"`
+	SenderID       int       `json:"-" gorm:"index;not null"`
+	Sender         string    `json:"sender" gorm:"->;-:migration"` // Username, selected with a join
+	Content        string    `json:"content" gorm:"size:1000;not null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// MessageDeletion hides a message from one participant only.
+type MessageDeletion struct {
+	MessageID int `gorm:"primaryKey"`
+	UserID    int `gorm:"primaryKey;index"`
+}
+
+type ParticipantResponse struct {
+	Username          string `json:"username"`
+	FirstName         string `json:"first_name"`
+	LastName          string `json:"last_name"`
+	Role              string `json:"role"`
+	LastReadMessageID int    `json:"last_read_message_id"`
+}
+
+type ConversationResponse struct {
+	ConversationID int                   `json:"conversation_id"`
+	Kind           string                `json:"kind"`
+	Name           *string               `json:"name"`
+	Participants   []ParticipantResponse `json:"participants"`
+	LastMessage    *Message              `json:"last_message"`
+	LastMessageAt  time.Time             `json:"last_message_at"`
+	Unread         int                   `json:"unread"`
+}
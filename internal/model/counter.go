@@ -0,0 +1,10 @@
+package model
+
+// CounterDrift is a denormalized counter that differs from the rows it counts.
+type CounterDrift struct {
+	Table   string // posts or users
+	ID      int
+	Counter string // Column of the counter
+	Stored  int
+	Actual  int
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// DataExport is a requested archive of everything tied to a user.
+type DataExport struct {
+	DataExportID int        `json:"export_id" gorm:"primaryKey;autoIncrement"`
+	UserID       int        `json:"-" gorm:"index;not null"`
+	Status       string     `json:"status" gorm:"size:16;not null;index"`
+	Error        string     `json:"error,omitempty" gorm:"size:256"`
+	Size         int64      `json:"size,omitempty"` // Bytes
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	StartedAt    *time.Time `json:"-" gorm:"default:null"`
+	CompletedAt  *time.Time `json:"completed_at" gorm:"default:null"`
+	ExpiresAt    *time.Time `json:"expires_at" gorm:"default:null"` // The download link stops working
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// DataImport recreates a user's history from an uploaded archive.
+type DataImport struct {
+	DataImportID int             `json:"import_id" gorm:"primaryKey;autoIncrement"`
+	UserID       int             `json:"-" gorm:"index;not null"`
+	Status       string          `json:"status" gorm:"size:16;not null;index"`
+	Format       string          `json:"format,omitempty" gorm:"size:32"` // Detected when processing starts
+	File         string          `json:"-" gorm:"size:64;not null"`       // Upload in the import directory
+	Error        string          `json:"error,omitempty" gorm:"size:256"`
+	Total        int             `json:"total"`
+	Imported     int             `json:"imported"`
+	Failed       int             `json:"failed"`
+	CreatedAt    time.Time       `json:"created_at" gorm:"autoCreateTime"`
+	StartedAt    *time.Time      `json:"-" gorm:"default:null"`
+	HeartbeatAt  *time.Time      `json:"-" gorm:"default:null"` // Refreshed by the worker while it runs
+	CompletedAt  *time.Time      `json:"completed_at" gorm:"default:null"`
+	Failures     []ImportFailure `json:"failures,omitempty" gorm:"foreignKey:DataImportID"`
+}
+
+// ImportFailure is an archive item that could not be imported as is.
+type ImportFailure struct {
+	ImportFailureID int    `json:"-" gorm:"primaryKey;autoIncrement"`
+	DataImportID    int    `json:"-" gorm:"index;not null"`
+	Item            string `json:"item" gorm:"size:128;not null"` // e.g. "post:123" or "follow:john_doe22"
+	Reason          string `json:"reason" gorm:"size:256;not null"`
+}
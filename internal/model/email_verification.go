@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// EmailVerificationToken proves ownership of Email, which becomes the user's
+// address once verified (on registration or when changing it).
+type EmailVerificationToken struct {
+	EmailVerificationTokenID int        `gorm:"primaryKey;autoIncrement"`
+	UserID                   int        `gorm:"index;not null"`
+	Email                    string     `gorm:"not null"`
+	TokenHash                string     `gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt                time.Time  `gorm:"not null"`
+	UsedAt                   *time.Time `gorm:"default:null"`
+	CreatedAt                time.Time  `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Job statuses
+const (
+	JobPending   = "pending" // Waiting for run_at, also after a failed attempt
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead" // Failed every attempt, kept until requeued or removed
+)
+
+// Job is a unit of background work run by a worker of its queue.
+type Job struct {
+	JobID       int64      `gorm:"primaryKey;autoIncrement"`
+	Queue       string     `gorm:"size:32;not null;index:idx_jobs_due,priority:1"`
+	Type        string     `gorm:"size:64;not null"`
+	Payload     string     `gorm:"type:text;not null"`
+	Status      string     `gorm:"size:16;not null;index:idx_jobs_due,priority:2"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_due,priority:3"` // Lease expiry while running
+	Attempts    int        `gorm:"not null;default:0"`
+	LastError   string     `gorm:"size:512"`
+	UniqueKey   *string    `gorm:"size:128;uniqueIndex"` // Set on scheduled runs of cron jobs
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	StartedAt   *time.Time `gorm:"default:null"`
+	CompletedAt *time.Time `gorm:"default:null"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+type LoginEvent struct {
+	LoginEventID int       `json:"login_event_id" gorm:"primaryKey;autoIncrement"`
+	UserID       int       `json:"-" gorm:"index;not null"`
+	IP           string    `json:"ip" gorm:"size:45;not null"`
+	UserAgent    string    `json:"user_agent" gorm:"size:512"`
+	Success      bool      `json:"success" gorm:"not null"`
+	Reason       string    `json:"reason,omitempty" gorm:"size:32"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// LoginThrottle counts consecutive failed logins per key ("user:<username>" or "ip:<addr>").
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey;size:128"`
+	Failures      int        `gorm:"not null;default:0"`
+	LastFailureAt time.Time  `gorm:"not null"`
+	LockedUntil   *time.Time `gorm:"default:null"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+type TOTP struct {
+	UserID       int        `gorm:"primaryKey"`
+	Secret       string     `gorm:"size:64;not null"`
+	Enabled      bool       `gorm:"not null;default:false"`
+	LastUsedStep int64      `gorm:"not null;default:0"` // Rejects replay of an accepted code
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+	ConfirmedAt  *time.Time `gorm:"default:null"`
+}
+
+type RecoveryCode struct {
+	RecoveryCodeID int        `gorm:"primaryKey;autoIncrement"`
+	UserID         int        `gorm:"index;not null"`
+	CodeHash       string     `gorm:"size:64;not null"` // SHA-256, codes are random so no slow hash is needed
+	UsedAt         *time.Time `gorm:"default:null"`
+}
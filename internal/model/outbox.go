@@ -0,0 +1,130 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Outbox event statuses
+const (
+	OutboxPending   = "pending"
+	OutboxProcessed = "processed"
+	OutboxFailed    = "failed" // A subscriber failed every attempt
+)
+
+// Aggregates domain events are ordered by
+const (
+	AggregatePost = "post"
+	AggregateUser = "user"
+)
+
+// OutboxEvent is a domain event recorded in the transaction of the change it
+// describes, then dispatched to subscribers by the relay.
+type OutboxEvent struct {
+	OutboxEventID int64      `gorm:"primaryKey;autoIncrement"`
+	AggregateType string     `gorm:"size:16;not null;index:idx_outbox_events_aggregate,priority:1"`
+	AggregateID   int        `gorm:"not null;index:idx_outbox_events_aggregate,priority:2"`
+	Type          string     `gorm:"size:64;not null"`
+	Payload       string     `gorm:"type:text;not null"`
+	Status        string     `gorm:"size:16;not null;index:idx_outbox_events_due,priority:1"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"size:256"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_events_due,priority:2"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+	ProcessedAt   *time.Time `gorm:"default:null"`
+}
+
+// DomainEvent is a change to an aggregate. Events of the same aggregate are
+// dispatched in the order they were recorded.
+type DomainEvent interface {
+	EventType() string
+	Aggregate() (string, int)
+}
+
+// Domain event types
+const (
+	EventPostCreated    = "PostCreated"
+	EventPostDeleted    = "PostDeleted"
+	EventPostLiked      = "PostLiked"
+	EventPostUnliked    = "PostUnliked"
+	EventPostReposted   = "PostReposted"
+	EventPostUnreposted = "PostUnreposted"
+	EventUserFollowed   = "UserFollowed"
+	EventUserUnfollowed = "UserUnfollowed"
+)
+
+type PostCreated struct {
+	PostID         int  `json:"post_id"`
+	UserID         int  `json:"user_id"`
+	OriginalPostID *int `json:"original_post_id,omitempty"` // Set on quotes
+	Imported       bool `json:"imported,omitempty"`         // Restored from an archive
+}
+
+type PostDeleted struct {
+	PostID int `json:"post_id"`
+	UserID int `json:"user_id"`
+}
+
+// PostInteraction is the payload of likes and reposts and their undoing.
+type PostInteraction struct {
+	PostID   int `json:"post_id"`
+	AuthorID int `json:"author_id"` // Of the post
+	UserID   int `json:"user_id"`   // Who interacted
+}
+
+type PostLiked PostInteraction
+type PostUnliked PostInteraction
+type PostReposted PostInteraction
+type PostUnreposted PostInteraction
+
+// FollowChange is the payload of follows and unfollows, ordered by follower.
+type FollowChange struct {
+	FollowerID  int `json:"follower_id"`
+	FollowingID int `json:"following_id"`
+}
+
+type UserFollowed FollowChange
+type UserUnfollowed FollowChange
+
+func (PostCreated) EventType() string             { return EventPostCreated }
+func (PostDeleted) EventType() string             { return EventPostDeleted }
+func (PostLiked) EventType() string               { return EventPostLiked }
+func (PostUnliked) EventType() string             { return EventPostUnliked }
+func (PostReposted) EventType() string            { return EventPostReposted }
+func (PostUnreposted) EventType() string          { return EventPostUnreposted }
+func (UserFollowed) EventType() string            { return EventUserFollowed }
+func (UserUnfollowed) EventType() string          { return EventUserUnfollowed }
+func (e PostCreated) Aggregate() (string, int)    { return AggregatePost, e.PostID }
+func (e PostDeleted) Aggregate() (string, int)    { return AggregatePost, e.PostID }
+func (e PostLiked) Aggregate() (string, int)      { return AggregatePost, e.PostID }
+func (e PostUnliked) Aggregate() (string, int)    { return AggregatePost, e.PostID }
+func (e PostReposted) Aggregate() (string, int)   { return AggregatePost, e.PostID }
+func (e PostUnreposted) Aggregate() (string, int) { return AggregatePost, e.PostID }
+func (e UserFollowed) Aggregate() (string, int)   { return AggregateUser, e.FollowerID }
+func (e UserUnfollowed) Aggregate() (string, int) { return AggregateUser, e.FollowerID }
+
+var domainEvents = map[string]func() DomainEvent{
+	EventPostCreated:    func() DomainEvent { return &PostCreated{} },
+	EventPostDeleted:    func() DomainEvent { return &PostDeleted{} },
+	EventPostLiked:      func() DomainEvent { return &PostLiked{} },
+	EventPostUnliked:    func() DomainEvent { return &PostUnliked{} },
+	EventPostReposted:   func() DomainEvent { return &PostReposted{} },
+	EventPostUnreposted: func() DomainEvent { return &PostUnreposted{} },
+	EventUserFollowed:   func() DomainEvent { return &UserFollowed{} },
+	EventUserUnfollowed: func() DomainEvent { return &UserUnfollowed{} },
+}
+
+// DecodeDomainEvent returns the payload of an outbox event as a pointer to its
+// event type, such as *PostLiked.
+func DecodeDomainEvent(event *OutboxEvent) (DomainEvent, error) {
+	newEvent, ok := domainEvents[event.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown domain event type %q", event.Type)
+	}
+	data := newEvent()
+	if err := json.Unmarshal([]byte(event.Payload), data); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", event.Type, err)
+	}
+	return data, nil
+}
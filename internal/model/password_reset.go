@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+type PasswordResetToken struct {
+	PasswordResetTokenID int        `gorm:"primaryKey;autoIncrement"`
+	UserID               int        `gorm:"index;not null"`
+	TokenHash            string     `gorm:"size:64;uniqueIndex;not null"` // SHA-256 of the emailed token
+	ExpiresAt            time.Time  `gorm:"not null"`
+	UsedAt               *time.Time `gorm:"default:null"`
+	CreatedAt            time.Time  `gorm:"autoCreateTime"`
+}
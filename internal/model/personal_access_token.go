@@ -0,0 +1,32 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Personal access token scopes. Routes without a scope accept sessions only.
+const (
+	ScopeUsersRead    = "users:read"
+	ScopePostsRead    = "posts:read"
+	ScopePostsWrite   = "posts:write"
+	ScopeFollowsWrite = "follows:write"
+)
+
+// PersonalAccessToken is a long-lived token for automation, limited to its scopes.
+type PersonalAccessToken struct {
+	PersonalAccessTokenID int        `json:"token_id" gorm:"primaryKey;autoIncrement"`
+	UserID                int        `json:"-" gorm:"index;not null"`
+	Name                  string     `json:"name" gorm:"size:64;not null"`
+	Prefix                string     `json:"prefix" gorm:"size:16;not null"` // Identifies the token in listings
+	TokenHash             string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Scopes                []string   `json:"scopes" gorm:"serializer:json;not null"`
+	ExpiresAt             *time.Time `json:"expires_at" gorm:"default:null"`
+	LastUsedAt            *time.Time `json:"last_used_at" gorm:"default:null"`
+	CreatedAt             time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	RevokedAt             *time.Time `json:"-" gorm:"default:null"`
+}
+
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// Session is one sign-in of a user. Access tokens carry its ID in the "sid"
+// claim and stop working once it is revoked or expired.
+type Session struct {
+	SessionID  string     `json:"session_id" gorm:"primaryKey;size:32"`
+	UserID     int        `json:"-" gorm:"index;not null"`
+	IP         string     `json:"ip" gorm:"size:45;not null"`
+	UserAgent  string     `json:"user_agent" gorm:"size:512"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"-" gorm:"default:null"`
+	Current    bool       `json:"current" gorm:"-"`
+}
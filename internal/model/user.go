@@ -7,6 +7,7 @@ import (
 type User struct {
 	UserID        int       `json:"user_id" gorm:"primaryKey;autoIncrement"`
 	Username      string    `json:"username" gorm:"unique;not null"`
+	Email         *string   `json:"email" gorm:"unique;default:null"`
 	Password      string    `json:"password" gorm:"not null"`
 	FirstName     string    `json:"first_name" gorm:"not null"`
 	LastName      string    `json:"last_name" gorm:"not null"`
@@ -17,6 +18,16 @@ type User struct {
 	Following     int       `json:"following" gorm:"default:0"`
 	FollowersList []User    `gorm:"many2many:followers;foreignKey:UserID;joinForeignKey:FollowingID;References:UserID;joinReferences:FollowerID"`
 	FollowingList []User    `gorm:"many2many:followers;foreignKey:UserID;joinForeignKey:FollowerID;References:UserID;joinReferences:FollowingID"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at" gorm:"default:null"`
+	DMPermission    string     `json:"dm_permission" gorm:"size:16;not null;default:everyone"`
+	// Deactivated and deleted accounts are hidden until reactivated or removed
+	DeactivatedAt       *time.Time `json:"-" gorm:"default:null;index"`
+	DeletionRequestedAt *time.Time `json:"-" gorm:"default:null;index"`
+}
+
+func (u *User) Visible() bool {
+	return u.DeactivatedAt == nil && u.DeletionRequestedAt == nil
 }
 
 type Follower struct {
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending" // Waiting for its next attempt
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // Every attempt failed or the webhook was disabled
+)
+
+// Webhook is an endpoint notified about activity on its owner's account.
+type Webhook struct {
+	WebhookID           int        `json:"webhook_id" gorm:"primaryKey;autoIncrement"`
+	UserID              int        `json:"-" gorm:"index;not null"`
+	URL                 string     `json:"url" gorm:"size:2048;not null"`
+	Secret              string     `json:"-" gorm:"size:64;not null"` // Signs deliveries, shown once on creation
+	Events              []string   `json:"events" gorm:"serializer:json;not null"`
+	ConsecutiveFailures int        `json:"consecutive_failures" gorm:"not null;default:0"` // Deliveries that failed every attempt
+	DisabledAt          *time.Time `json:"disabled_at" gorm:"default:null"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// WebhookDelivery is an event queued for a webhook, retried until it succeeds
+// or runs out of attempts.
+type WebhookDelivery struct {
+	WebhookDeliveryID int              `json:"delivery_id" gorm:"primaryKey;autoIncrement"`
+	WebhookID         int              `json:"-" gorm:"not null;uniqueIndex:idx_webhook_deliveries_event,priority:1"`
+	OutboxEventID     *int64           `json:"-" gorm:"uniqueIndex:idx_webhook_deliveries_event,priority:2"` // Domain event delivered, nil on pings
+	Event             string           `json:"event" gorm:"size:32;not null"`
+	Payload           string           `json:"-" gorm:"type:text;not null"` // Request body, signed as is
+	Status            string           `json:"status" gorm:"size:16;not null;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts          int              `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt     time.Time        `json:"next_attempt_at" gorm:"not null;index:idx_webhook_deliveries_due,priority:2"`
+	CreatedAt         time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	CompletedAt       *time.Time       `json:"completed_at" gorm:"default:null"`
+	AttemptLog        []WebhookAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:WebhookDeliveryID"`
+}
+
+// WebhookAttempt records one request of a delivery.
+type WebhookAttempt struct {
+	WebhookAttemptID  int       `json:"-" gorm:"primaryKey;autoIncrement"`
+	WebhookDeliveryID int       `json:"-" gorm:"index;not null"`
+	StatusCode        int       `json:"status_code"` // 0 without a response
+	Error             string    `json:"error,omitempty" gorm:"size:256"`
+	DurationMS        int64     `json:"duration_ms"`
+	AttemptedAt       time.Time `json:"attempted_at" gorm:"not null"`
+}
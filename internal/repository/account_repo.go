@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountRepository struct {
+	db *gorm.DB
+}
+
+func NewAccountRepository(db *gorm.DB) *AccountRepository {
+	return &AccountRepository{db: db}
+}
+
+// DeactivateUser hides the account and signs out all its sessions and tokens.
+func (r *AccountRepository) DeactivateUser(ctx context.Context, userID int) error {
+	return r.hideUser(ctx, userID, "deactivated_at")
+}
+
+// RequestUserDeletion hides the account until the deletion worker removes it.
+func (r *AccountRepository) RequestUserDeletion(ctx context.Context, userID int) error {
+	return r.hideUser(ctx, userID, "deletion_requested_at")
+}
+
+func (r *AccountRepository) hideUser(ctx context.Context, userID int, column string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// UpdateUser
+		if err := tx.Model(&model.User{}).Where("user_id = ?", userID).Update(column, now).Error; err != nil {
+			return err
+		}
+
+		// RevokeSessions
+		if err := tx.Model(&model.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// RevokeTokens
+		return tx.Model(&model.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (r *AccountRepository) ReactivateUser(ctx context.Context, userID int) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).Where("user_id = ?", userID).Update("deactivated_at", nil).Error
+}
+
+// GetUsersPendingDeletion returns accounts whose deletion was requested or
+// which stayed deactivated since before deactivatedBefore.
+func (r *AccountRepository) GetUsersPendingDeletion(ctx context.Context, deactivatedBefore time.Time, limit int) ([]int, error) {
+	var userIDs []int
+	if err := r.db.WithContext(ctx).Model(&model.User{}).
+		Where("deletion_requested_at IS NOT NULL OR deactivated_at < ?", deactivatedBefore).
+		Order("user_id").
+		Limit(limit).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// accountDeletionEvents lists what deleting the user undoes: their likes,
+// reposts and follows in both directions, and their posts.
+func accountDeletionEvents(tx *gorm.DB, userID int) ([]model.DomainEvent, error) {
+	var events []model.DomainEvent
+
+	var likes, reposts []model.PostInteraction
+	if err := tx.Table("likes").
+		Select("likes.liked_post_id AS post_id, posts.user_id AS author_id, likes.user_id").
+		Joins("JOIN posts ON posts.post_id = likes.liked_post_id").
+		Where("likes.user_id = ?", userID).
+		Scan(&likes).Error; err != nil {
+		return nil, err
+	}
+	for _, like := range likes {
+		events = append(events, model.PostUnliked(like))
+	}
+	if err := tx.Table("reposts").
+		Select("reposts.reposted_post_id AS post_id, posts.user_id AS author_id, reposts.user_id").
+		Joins("JOIN posts ON posts.post_id = reposts.reposted_post_id").
+		Where("reposts.user_id = ?", userID).
+		Scan(&reposts).Error; err != nil {
+		return nil, err
+	}
+	for _, repost := range reposts {
+		events = append(events, model.PostUnreposted(repost))
+	}
+
+	var follows []model.FollowChange
+	if err := tx.Table("followers").
+		Select("follower_id, following_id").
+		Where("follower_id = ? OR following_id = ?", userID, userID).
+		Scan(&follows).Error; err != nil {
+		return nil, err
+	}
+	for _, follow := range follows {
+		events = append(events, model.UserUnfollowed(follow))
+	}
+
+	var postIDs []int
+	if err := tx.Model(&model.Post{}).Where("user_id = ?", userID).Order("post_id").Pluck("post_id", &postIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, postID := range postIDs {
+		events = append(events, model.PostDeleted{PostID: postID, UserID: userID})
+	}
+	return events, nil
+}
+
+// DeleteUser permanently removes an account pending deletion with everything
+// it owns, fixes the counters of the posts and users it touched and records
+// the matching unlike, unrepost, unfollow and post deletion events. Returns
+// false when the account is no longer pending or another worker holds it.
+func (r *AccountRepository) DeleteUser(ctx context.Context, userID int, deactivatedBefore time.Time) (bool, error) {
+	deleted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockUser
+		var user model.User
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("user_id = ? AND (deletion_requested_at IS NOT NULL OR deactivated_at < ?)", userID, deactivatedBefore).
+			Limit(1).Find(&user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		// RecordEvents, while the rows they describe still exist
+		events, err := accountDeletionEvents(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := recordEvents(tx, events...); err != nil {
+			return err
+		}
+
+		// DecrementLikes
+		if err := tx.Exec(`UPDATE posts SET likes = likes - 1
+			WHERE post_id IN (SELECT liked_post_id FROM likes WHERE user_id = ?)`, userID).Error; err != nil {
+			return err
+		}
+		// DecrementReposts
+		if err := tx.Exec(`UPDATE posts SET reposts = reposts - 1
+			WHERE post_id IN (SELECT reposted_post_id FROM reposts WHERE user_id = ?)`, userID).Error; err != nil {
+			return err
+		}
+		// DecrementFollowers
+		if err := tx.Exec(`UPDATE users SET followers = followers - 1
+			WHERE user_id IN (SELECT following_id FROM followers WHERE follower_id = ?)`, userID).Error; err != nil {
+			return err
+		}
+		// DecrementFollowing
+		if err := tx.Exec(`UPDATE users SET following = following - 1
+			WHERE user_id IN (SELECT follower_id FROM followers WHERE following_id = ?)`, userID).Error; err != nil {
+			return err
+		}
+
+		// DeleteInteractions
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Repost{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("follower_id = ? OR following_id = ?", userID, userID).Delete(&model.Follower{}).Error; err != nil {
+			return err
+		}
+
+		// DeletePosts, quotes by other users stay as standalone posts
+		if err := tx.Where("liked_post_id IN (SELECT post_id FROM posts WHERE user_id = ?)", userID).Delete(&model.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("reposted_post_id IN (SELECT post_id FROM posts WHERE user_id = ?)", userID).Delete(&model.Repost{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Post{}).
+			Where("original_post_id IN (SELECT post_id FROM posts WHERE user_id = ?) AND user_id <> ?", userID, userID).
+			Update("original_post_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Post{}).Error; err != nil {
+			return err
+		}
+
+		// DeleteMessages, conversations keep the other participants' messages
+		var conversationIDs []int
+		if err := tx.Model(&model.ConversationParticipant{}).Where("user_id = ?", userID).Pluck("conversation_id", &conversationIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR message_id IN (SELECT message_id FROM messages WHERE sender_id = ?)", userID, userID).Delete(&model.MessageDeletion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sender_id = ?", userID).Delete(&model.Message{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.ConversationParticipant{}).Error; err != nil {
+			return err
+		}
+		if len(conversationIDs) > 0 {
+			if err := tx.Model(&model.Conversation{}).Where("conversation_id IN ?", conversationIDs).
+				Update("last_message_id", gorm.Expr("(SELECT MAX(message_id) FROM messages WHERE messages.conversation_id = conversations.conversation_id)")).Error; err != nil {
+				return err
+			}
+			if err := promoteOldestMembers(tx, conversationIDs); err != nil {
+				return err
+			}
+			var emptyIDs []int
+			if err := tx.Model(&model.Conversation{}).
+				Where("conversation_id IN ? AND conversation_id NOT IN (SELECT conversation_id FROM conversation_participants)", conversationIDs).
+				Pluck("conversation_id", &emptyIDs).Error; err != nil {
+				return err
+			}
+			if len(emptyIDs) > 0 {
+				if err := deleteConversations(tx, emptyIDs); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&model.Block{}).Error; err != nil {
+			return err
+		}
+
+		// DeleteAccountData
+		if err := tx.Where("data_import_id IN (SELECT data_import_id FROM data_imports WHERE user_id = ?)", userID).Delete(&model.ImportFailure{}).Error; err != nil {
+			return err
+		}
+		if err := deleteDeliveries(tx, "webhook_id IN (SELECT webhook_id FROM webhooks WHERE user_id = ?)", userID); err != nil {
+			return err
+		}
+		for _, m := range []interface{}{
+			&model.Session{},
+			&model.PersonalAccessToken{},
+			&model.LoginEvent{},
+			&model.TOTP{},
+			&model.RecoveryCode{},
+			&model.PasswordResetToken{},
+			&model.EmailVerificationToken{},
+			&model.DataExport{}, // Archives are swept by the export worker
+			&model.DataImport{}, // Uploads are swept by the import worker
+			&model.Webhook{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("key = ?", "user:"+user.Username).Delete(&model.LoginThrottle{}).Error; err != nil {
+			return err
+		}
+
+		// DeleteUser
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
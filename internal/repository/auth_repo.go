@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"context"
+	"time"
 	"x-clone/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthRepository struct {
@@ -14,6 +17,147 @@ func NewAuthRepository(db *gorm.DB) *AuthRepository {
 	return &AuthRepository{db: db}
 }
 
-func (r *AuthRepository) CreateUser(user *model.User) error {
-	return r.db.Create(user).Error
+func (r *AuthRepository) CreateUser(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *AuthRepository) GetLoginThrottles(ctx context.Context, keys []string) ([]model.LoginThrottle, error) {
+	var throttles []model.LoginThrottle
+	if err := r.db.WithContext(ctx).Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return nil, err
+	}
+	return throttles, nil
+}
+
+// IncrementLoginFailures atomically counts a failure, restarting the count
+// when the previous failure is older than window.
+func (r *AuthRepository) IncrementLoginFailures(ctx context.Context, key string, window time.Duration) (*model.LoginThrottle, error) {
+	var throttle model.LoginThrottle
+	err := r.db.WithContext(ctx).Raw(`
+		INSERT INTO login_throttles (key, failures, last_failure_at)
+		VALUES (?, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < now() - make_interval(secs => ?) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = now()
+		RETURNING *`, key, window.Seconds()).Scan(&throttle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (r *AuthRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.LoginThrottle{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (r *AuthRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("key = ?", key).Delete(&model.LoginThrottle{}).Error
+}
+
+func (r *AuthRepository) CreateLoginEvent(ctx context.Context, event *model.LoginEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *AuthRepository) GetLoginEvents(ctx context.Context, userID, limit int) ([]model.LoginEvent, error) {
+	var events []model.LoginEvent
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *AuthRepository) CreatePasswordResetToken(ctx context.Context, token *model.PasswordResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// ResetPassword consumes a valid reset token, sets the new password, revokes
+// all sessions and invalidates the user's other outstanding reset tokens.
+func (r *AuthRepository) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (int, error) {
+	var token model.PasswordResetToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// GetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			First(&token).Error; err != nil {
+			return err
+		}
+
+		// UpdatePassword
+		now := time.Now()
+		if err := tx.Model(&model.User{}).Where("user_id = ?", token.UserID).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+
+		// RevokeSessions
+		if err := tx.Model(&model.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", token.UserID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// RevokeAccessTokens, created by whoever held the old password
+		if err := tx.Model(&model.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", token.UserID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// UseTokens
+		return tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return token.UserID, nil
+}
+
+// CreateEmailVerificationToken replaces the user's outstanding verification tokens.
+func (r *AuthRepository) CreateEmailVerificationToken(ctx context.Context, token *model.EmailVerificationToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// VerifyEmail consumes a valid verification token and makes its email the
+// user's verified address.
+func (r *AuthRepository) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	var token model.EmailVerificationToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// GetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			First(&token).Error; err != nil {
+			return err
+		}
+
+		// UpdateEmail
+		now := time.Now()
+		if err := tx.Model(&model.User{}).Where("user_id = ?", token.UserID).Updates(map[string]interface{}{
+			"email":             token.Email,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+
+		// UseToken
+		return tx.Model(&token).Update("used_at", now).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return token.UserID, nil
 }
@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ConversationRepository struct {
+	db *gorm.DB
+}
+
+func NewConversationRepository(db *gorm.DB) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+// SendDirectMessage adds the message to the conversation between the two users,
+// creating it on the first message.
+func (r *ConversationRepository) SendDirectMessage(ctx context.Context, directKey string, senderID, recipientID int, message *model.Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// CreateConversation
+		conversation := &model.Conversation{Kind: model.ConversationDirect, DirectKey: &directKey, LastMessageAt: time.Now()}
+		if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "direct_key"}}, DoNothing: true}).
+			Create(conversation).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("direct_key = ?", directKey).First(conversation).Error; err != nil {
+			return err
+		}
+
+		// CreateParticipants
+		participants := []model.ConversationParticipant{
+			{ConversationID: conversation.ConversationID, UserID: senderID},
+			{ConversationID: conversation.ConversationID, UserID: recipientID},
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error; err != nil {
+			return err
+		}
+
+		message.ConversationID = conversation.ConversationID
+		return createMessage(tx, message)
+	})
+}
+
+func (r *ConversationRepository) CreateMessage(ctx context.Context, message *model.Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createMessage(tx, message)
+	})
+}
+
+// createMessage stores the message as the conversation's latest, read by its sender.
+func createMessage(tx *gorm.DB, message *model.Message) error {
+	// CreateMessage
+	if err := tx.Create(message).Error; err != nil {
+		return err
+	}
+
+	// UpdateLastMessage
+	if err := tx.Model(&model.Conversation{}).Where("conversation_id = ?", message.ConversationID).Updates(map[string]interface{}{
+		"last_message_id": message.MessageID,
+		"last_message_at": message.CreatedAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	// MarkRead
+	return tx.Model(&model.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", message.ConversationID, message.SenderID).
+		Update("last_read_message_id", message.MessageID).Error
+}
+
+// CreateGroup creates the group with its creator as admin and the system message announcing it.
+func (r *ConversationRepository) CreateGroup(ctx context.Context, conversation *model.Conversation, creatorID int, memberIDs []int, message *model.Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// CreateConversation
+		conversation.Kind = model.ConversationGroup
+		conversation.LastMessageAt = time.Now()
+		if err := tx.Create(conversation).Error; err != nil {
+			return err
+		}
+
+		// CreateParticipants
+		participants := []model.ConversationParticipant{
+			{ConversationID: conversation.ConversationID, UserID: creatorID, Role: model.ParticipantAdmin},
+		}
+		for _, memberID := range memberIDs {
+			participants = append(participants, model.ConversationParticipant{
+				ConversationID: conversation.ConversationID,
+				UserID:         memberID,
+				Role:           model.ParticipantMember,
+			})
+		}
+		if err := tx.Create(&participants).Error; err != nil {
+			return err
+		}
+
+		message.ConversationID = conversation.ConversationID
+		return createMessage(tx, message)
+	})
+}
+
+// AddParticipants adds members to a group on behalf of actorID. It returns
+// false when the actor is no longer an admin or the group would grow past
+// maxParticipants.
+func (r *ConversationRepository) AddParticipants(ctx context.Context, conversationID, actorID int, userIDs []int, maxParticipants int, message *model.Message) (bool, error) {
+	added := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockConversation, concurrent additions and role changes are checked one after another
+		var conversation model.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ?", conversationID).
+			First(&conversation).Error; err != nil {
+			return err
+		}
+
+		// CheckAdmin
+		var admins int64
+		if err := tx.Model(&model.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ? AND role = ?", conversationID, actorID, model.ParticipantAdmin).
+			Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins == 0 {
+			return nil
+		}
+
+		// CountParticipants
+		var count int64
+		if err := tx.Model(&model.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id NOT IN ?", conversationID, userIDs).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count)+len(userIDs) > maxParticipants {
+			return nil // Group is full
+		}
+
+		// CreateParticipants
+		participants := make([]model.ConversationParticipant, 0, len(userIDs))
+		for _, userID := range userIDs {
+			participants = append(participants, model.ConversationParticipant{
+				ConversationID: conversationID,
+				UserID:         userID,
+				Role:           model.ParticipantMember,
+			})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error; err != nil {
+			return err
+		}
+
+		added = true
+		message.ConversationID = conversationID
+		return createMessage(tx, message)
+	})
+	return added, err
+}
+
+// RemoveParticipant removes a member from a group on behalf of actorID, who
+// must be an admin unless they remove themselves. It returns false when the
+// actor is no longer an admin. The removed member no longer sees the group's
+// messages, the longest standing member becomes admin when no admin is left
+// and a group without members is deleted.
+func (r *ConversationRepository) RemoveParticipant(ctx context.Context, conversationID, actorID, userID int, message *model.Message) (bool, error) {
+	removed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockConversation, removals are checked against concurrent role changes
+		var conversation model.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ?", conversationID).
+			First(&conversation).Error; err != nil {
+			return err
+		}
+
+		// CheckAdmin
+		if actorID != userID {
+			var count int64
+			if err := tx.Model(&model.ConversationParticipant{}).
+				Where("conversation_id = ? AND user_id = ? AND role = ?", conversationID, actorID, model.ParticipantAdmin).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return nil
+			}
+		}
+
+		// DeleteParticipant
+		result := tx.Where("conversation_id = ? AND user_id = ?", conversationID, userID).Delete(&model.ConversationParticipant{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("user_id = ? AND message_id IN (SELECT message_id FROM messages WHERE conversation_id = ?)", userID, conversationID).
+			Delete(&model.MessageDeletion{}).Error; err != nil {
+			return err
+		}
+
+		// DeleteEmptyConversation
+		var count int64
+		if err := tx.Model(&model.ConversationParticipant{}).Where("conversation_id = ?", conversationID).Count(&count).Error; err != nil {
+			return err
+		}
+		removed = true
+		if count == 0 {
+			return deleteConversations(tx, []int{conversationID})
+		}
+
+		// PromoteAdmin
+		if err := promoteOldestMembers(tx, []int{conversationID}); err != nil {
+			return err
+		}
+
+		message.ConversationID = conversationID
+		return createMessage(tx, message)
+	})
+	return removed, err
+}
+
+// promoteOldestMembers makes the longest standing member admin of every group without one.
+func promoteOldestMembers(tx *gorm.DB, conversationIDs []int) error {
+	return tx.Exec(`UPDATE conversation_participants SET role = ?
+		WHERE (conversation_id, user_id) IN (
+			SELECT DISTINCT ON (p.conversation_id) p.conversation_id, p.user_id
+			FROM conversation_participants p JOIN conversations c ON c.conversation_id = p.conversation_id
+			WHERE p.conversation_id IN ? AND c.kind = ? AND NOT EXISTS (
+				SELECT 1 FROM conversation_participants a WHERE a.conversation_id = p.conversation_id AND a.role = ?
+			)
+			ORDER BY p.conversation_id, p.joined_at, p.user_id
+		)`, model.ParticipantAdmin, conversationIDs, model.ConversationGroup, model.ParticipantAdmin).Error
+}
+
+// deleteConversations removes conversations with all their messages.
+func deleteConversations(tx *gorm.DB, conversationIDs []int) error {
+	if err := tx.Where("message_id IN (SELECT message_id FROM messages WHERE conversation_id IN ?)", conversationIDs).Delete(&model.MessageDeletion{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(&model.Message{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("conversation_id IN ?", conversationIDs).Delete(&model.Conversation{}).Error
+}
+
+// SetParticipantRole changes a member's role in a group on behalf of an admin.
+// It returns false when the actor is no longer an admin or the group would be
+// left without one.
+func (r *ConversationRepository) SetParticipantRole(ctx context.Context, conversationID, actorID, userID int, role string) (bool, error) {
+	changed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockConversation, concurrent role changes are checked one after another
+		var conversation model.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ?", conversationID).
+			First(&conversation).Error; err != nil {
+			return err
+		}
+
+		// CountAdmins
+		var admins []int
+		if err := tx.Model(&model.ConversationParticipant{}).
+			Where("conversation_id = ? AND role = ?", conversationID, model.ParticipantAdmin).
+			Pluck("user_id", &admins).Error; err != nil {
+			return err
+		}
+		if !slices.Contains(admins, actorID) {
+			return nil
+		}
+		if role != model.ParticipantAdmin && len(admins) == 1 && admins[0] == userID {
+			return nil // Last admin
+		}
+
+		// UpdateRole
+		result := tx.Model(&model.ConversationParticipant{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			Update("role", role)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
+}
+
+// RenameConversation sets the group's name, nil clears it.
+func (r *ConversationRepository) RenameConversation(ctx context.Context, conversationID int, name *string, message *model.Message) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// UpdateName
+		if err := tx.Model(&model.Conversation{}).Where("conversation_id = ?", conversationID).Update("name", name).Error; err != nil {
+			return err
+		}
+
+		message.ConversationID = conversationID
+		return createMessage(tx, message)
+	})
+}
+
+// GetConversation returns a conversation of the user with its participants.
+func (r *ConversationRepository) GetConversation(ctx context.Context, userID, conversationID int) (*model.Conversation, error) {
+	var conversation model.Conversation
+	if err := r.db.WithContext(ctx).
+		Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("joined_at, user_id")
+		}).
+		Preload("Participants.User").
+		Where("conversation_id = ? AND conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)", conversationID, userID).
+		First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// GetConversations returns the user's conversations by latest message, starting
+// after the (beforeAt, beforeID) cursor when beforeID is set.
+func (r *ConversationRepository) GetConversations(ctx context.Context, userID int, beforeAt time.Time, beforeID, limit int) ([]model.Conversation, error) {
+	query := r.db.WithContext(ctx).
+		Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("joined_at, user_id")
+		}).
+		Preload("Participants.User").
+		Where("conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)", userID)
+	if beforeID > 0 {
+		query = query.Where("(last_message_at, conversation_id) < (?, ?)", beforeAt, beforeID)
+	}
+
+	var conversations []model.Conversation
+	if err := query.Order("last_message_at DESC, conversation_id DESC").Limit(limit).Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// GetLastMessages returns the latest message of each conversation the user has not deleted.
+func (r *ConversationRepository) GetLastMessages(ctx context.Context, userID int, conversationIDs []int) (map[int]*model.Message, error) {
+	var messages []model.Message
+	if err := r.visibleMessages(ctx, userID).
+		Select("DISTINCT ON (messages.conversation_id) messages.*, users.username AS sender").
+		Where("messages.conversation_id IN ?", conversationIDs).
+		Order("messages.conversation_id, messages.message_id DESC").
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	last := make(map[int]*model.Message, len(messages))
+	for i := range messages {
+		last[messages[i].ConversationID] = &messages[i]
+	}
+	return last, nil
+}
+
+// GetUnreadCounts counts messages from others after the user's read receipt.
+func (r *ConversationRepository) GetUnreadCounts(ctx context.Context, userID int, conversationIDs []int) (map[int]int, error) {
+	var rows []struct {
+		ConversationID int
+		Unread         int
+	}
+	if err := r.visibleMessages(ctx, userID).
+		Select("messages.conversation_id, COUNT(*) AS unread").
+		Where("messages.conversation_id IN ? AND messages.message_id > p.last_read_message_id AND messages.sender_id <> ?", conversationIDs, userID).
+		Group("messages.conversation_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	unread := make(map[int]int, len(rows))
+	for _, row := range rows {
+		unread[row.ConversationID] = row.Unread
+	}
+	return unread, nil
+}
+
+// GetMessages returns the conversation's messages newest first, before beforeID when set.
+func (r *ConversationRepository) GetMessages(ctx context.Context, userID, conversationID, beforeID, limit int) ([]model.Message, error) {
+	query := r.visibleMessages(ctx, userID).
+		Select("messages.*, users.username AS sender").
+		Where("messages.conversation_id = ?", conversationID)
+	if beforeID > 0 {
+		query = query.Where("messages.message_id < ?", beforeID)
+	}
+
+	var messages []model.Message
+	if err := query.Order("messages.message_id DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// visibleMessages returns the messages sent since the user joined their
+// conversation (p), except those the user deleted for themselves.
+func (r *ConversationRepository) visibleMessages(ctx context.Context, userID int) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&model.Message{}).
+		Joins("JOIN conversation_participants p ON p.conversation_id = messages.conversation_id AND p.user_id = ?", userID).
+		Joins("LEFT JOIN users ON users.user_id = messages.sender_id").
+		Where("messages.created_at >= p.joined_at").
+		Where("NOT EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = messages.message_id AND d.user_id = ?)", userID)
+}
+
+// MarkConversationRead moves the user's read receipt to the latest message.
+func (r *ConversationRepository) MarkConversationRead(ctx context.Context, userID, conversationID int) error {
+	return r.db.WithContext(ctx).Model(&model.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("last_read_message_id", gorm.Expr(
+			"GREATEST(last_read_message_id, COALESCE((SELECT last_message_id FROM conversations WHERE conversation_id = ?), 0))", conversationID,
+		)).Error
+}
+
+// DeleteMessageForUser hides the message from the user only.
+func (r *ConversationRepository) DeleteMessageForUser(ctx context.Context, userID, conversationID, messageID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// FindMessage
+		var message model.Message
+		if err := tx.Where("message_id = ? AND conversation_id = ?", messageID, conversationID).First(&message).Error; err != nil {
+			return err
+		}
+
+		// CreateDeletion
+		deletion := &model.MessageDeletion{MessageID: messageID, UserID: userID}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(deletion).Error
+	})
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// counter is a denormalized counter column and the query counting its rows.
+type counter struct {
+	column string
+	count  string
+}
+
+var (
+	postCounters = []counter{
+		{"likes", "SELECT COUNT(*) FROM likes WHERE likes.liked_post_id = posts.post_id"},
+		{"reposts", "SELECT COUNT(*) FROM reposts WHERE reposts.reposted_post_id = posts.post_id"},
+	}
+	userCounters = []counter{
+		{"followers", "SELECT COUNT(*) FROM followers WHERE followers.following_id = users.user_id"},
+		{"following", "SELECT COUNT(*) FROM followers WHERE followers.follower_id = users.user_id"},
+	}
+)
+
+type CounterRepository struct {
+	db *gorm.DB
+}
+
+func NewCounterRepository(db *gorm.DB) *CounterRepository {
+	return &CounterRepository{db: db}
+}
+
+// ReconcilePostCounters checks the likes and reposts of up to limit posts
+// after afterID. It returns the last post checked and the number checked.
+func (r *CounterRepository) ReconcilePostCounters(ctx context.Context, afterID, limit int, fix bool) (int, int, []model.CounterDrift, error) {
+	return r.reconcile(ctx, "posts", "post_id", postCounters, afterID, limit, fix)
+}
+
+// ReconcileUserCounters checks the followers and following of up to limit
+// users after afterID. It returns the last user checked and the number checked.
+func (r *CounterRepository) ReconcileUserCounters(ctx context.Context, afterID, limit int, fix bool) (int, int, []model.CounterDrift, error) {
+	return r.reconcile(ctx, "users", "user_id", userCounters, afterID, limit, fix)
+}
+
+// reconcile compares the counters of a batch of rows with the rows they count
+// and, with fix, sets the drifted ones to the actual count. The batch is locked
+// while fixing so counter updates of concurrent likes and follows wait for it,
+// and each count, run after the lock in a statement of its own, sees those
+// committed before.
+func (r *CounterRepository) reconcile(ctx context.Context, table, key string, counters []counter, afterID, limit int, fix bool) (int, int, []model.CounterDrift, error) {
+	var lastID, checked int
+	var drifts []model.CounterDrift
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// SelectBatch
+		query := tx.Table(table).Where(key+" > ?", afterID).Order(key).Limit(limit)
+		if fix {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var ids []int
+		if err := query.Pluck(key, &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		lastID, checked = ids[len(ids)-1], len(ids)
+
+		for _, c := range counters {
+			// CountRows
+			var rows []struct {
+				ID     int
+				Stored int
+				Actual int
+			}
+			if err := tx.Table(table).
+				Select(fmt.Sprintf("%s AS id, %s AS stored, (%s) AS actual", key, c.column, c.count)).
+				Where(key+" IN ?", ids).
+				Where(fmt.Sprintf("%s <> (%s)", c.column, c.count)).
+				Order(key).
+				Scan(&rows).Error; err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				drifts = append(drifts, model.CounterDrift{Table: table, ID: row.ID, Counter: c.column, Stored: row.Stored, Actual: row.Actual})
+				if !fix {
+					continue
+				}
+				// FixCounter
+				if err := tx.Table(table).Where(key+" = ?", row.ID).Update(c.column, row.Actual).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return lastID, checked, drifts, nil
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ExportRepository struct {
+	db *gorm.DB
+}
+
+func NewExportRepository(db *gorm.DB) *ExportRepository {
+	return &ExportRepository{db: db}
+}
+
+// CreateExport queues the export unless the user has one created after since
+// that did not fail. The user is locked meanwhile, so concurrent requests
+// queue a single export.
+func (r *ExportRepository) CreateExport(ctx context.Context, export *model.DataExport, since time.Time) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockUser
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("user_id").
+			Where("user_id = ?", export.UserID).
+			First(&model.User{}).Error; err != nil {
+			return err
+		}
+
+		// CheckRecentExport
+		var count int64
+		if err := tx.Model(&model.DataExport{}).
+			Where("user_id = ? AND status <> ? AND created_at > ?", export.UserID, model.ExportFailed, since).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		// CreateExport
+		created = true
+		return tx.Create(export).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (r *ExportRepository) GetExport(ctx context.Context, userID, exportID int) (*model.DataExport, error) {
+	var export model.DataExport
+	if err := r.db.WithContext(ctx).Where("data_export_id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// StartExport marks the export as running. One left running by a crashed
+// worker is started again, a finished one returns gorm.ErrRecordNotFound.
+func (r *ExportRepository) StartExport(ctx context.Context, exportID int) (*model.DataExport, error) {
+	var export model.DataExport
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockExport
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("data_export_id = ? AND status IN ?", exportID, []string{model.ExportPending, model.ExportRunning}).
+			First(&export).Error; err != nil {
+			return err
+		}
+
+		// StartExport
+		now := time.Now()
+		export.Status = model.ExportRunning
+		export.StartedAt = &now
+		return tx.Model(&export).Updates(map[string]interface{}{
+			"status":     export.Status,
+			"started_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *ExportRepository) CompleteExport(ctx context.Context, exportID int, size int64, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.DataExport{}).Where("data_export_id = ?", exportID).Updates(map[string]interface{}{
+		"status":       model.ExportCompleted,
+		"size":         size,
+		"completed_at": time.Now(),
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+func (r *ExportRepository) FailExport(ctx context.Context, exportID int, message string) error {
+	return r.db.WithContext(ctx).Model(&model.DataExport{}).Where("data_export_id = ?", exportID).Updates(map[string]interface{}{
+		"status": model.ExportFailed,
+		"error":  message,
+	}).Error
+}
+
+// ExpireExports marks completed exports past their expiry as expired.
+func (r *ExportRepository) ExpireExports(ctx context.Context) error {
+	return r.db.WithContext(ctx).Model(&model.DataExport{}).
+		Where("status = ? AND expires_at < ?", model.ExportCompleted, time.Now()).
+		Update("status", model.ExportExpired).Error
+}
+
+// GetDownloadableExportIDs lists exports whose archive must be kept on disk.
+func (r *ExportRepository) GetDownloadableExportIDs(ctx context.Context) ([]int, error) {
+	var exportIDs []int
+	if err := r.db.WithContext(ctx).Model(&model.DataExport{}).
+		Where("status IN ?", []string{model.ExportRunning, model.ExportCompleted}).
+		Pluck("data_export_id", &exportIDs).Error; err != nil {
+		return nil, err
+	}
+	return exportIDs, nil
+}
+
+func (r *ExportRepository) GetLikedPosts(ctx context.Context, userID int) ([]model.Post, error) {
+	var posts []model.Post
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN likes ON likes.liked_post_id = posts.post_id").
+		Where("likes.user_id = ?", userID).
+		Order("posts.post_id").
+		Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *ExportRepository) GetRepostedPosts(ctx context.Context, userID int) ([]model.Post, error) {
+	var posts []model.Post
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN reposts ON reposts.reposted_post_id = posts.post_id").
+		Where("reposts.user_id = ?", userID).
+		Order("posts.post_id").
+		Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetUsernames maps user IDs to usernames.
+func (r *ExportRepository) GetUsernames(ctx context.Context, userIDs []int) (map[int]string, error) {
+	var users []model.User
+	if err := r.db.WithContext(ctx).Select("user_id", "username").Where("user_id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.UserID] = user.Username
+	}
+	return usernames, nil
+}
+
+func (r *ExportRepository) GetSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	var sessions []model.Session
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *ExportRepository) GetLoginEvents(ctx context.Context, userID int) ([]model.LoginEvent, error) {
+	var events []model.LoginEvent
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *ExportRepository) GetAccessTokens(ctx context.Context, userID int) ([]model.PersonalAccessToken, error) {
+	var tokens []model.PersonalAccessToken
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *ExportRepository) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *ExportRepository) GetBlockedUsers(ctx context.Context, userID int) ([]model.User, error) {
+	var users []model.User
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN blocks ON blocks.blocked_id = users.user_id").
+		Where("blocks.blocker_id = ?", userID).
+		Order("blocks.created_at").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetConversations returns the user's conversations with their participants.
+func (r *ExportRepository) GetConversations(ctx context.Context, userID int) ([]model.Conversation, error) {
+	var conversations []model.Conversation
+	if err := r.db.WithContext(ctx).
+		Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("joined_at, user_id")
+		}).
+		Preload("Participants.User").
+		Where("conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)", userID).
+		Order("conversation_id").
+		Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// GetMessages returns the messages sent since the user joined their
+// conversations, oldest first, except those the user deleted for themselves.
+func (r *ExportRepository) GetMessages(ctx context.Context, userID int) ([]model.Message, error) {
+	var messages []model.Message
+	if err := r.db.WithContext(ctx).Model(&model.Message{}).
+		Select("messages.*, users.username AS sender").
+		Joins("JOIN conversation_participants p ON p.conversation_id = messages.conversation_id AND p.user_id = ?", userID).
+		Joins("LEFT JOIN users ON users.user_id = messages.sender_id").
+		Where("messages.created_at >= p.joined_at").
+		Where("NOT EXISTS (SELECT 1 FROM message_deletions d WHERE d.message_id = messages.message_id AND d.user_id = ?)", userID).
+		Order("messages.message_id").
+		Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ImportRepository struct {
+	db *gorm.DB
+}
+
+func NewImportRepository(db *gorm.DB) *ImportRepository {
+	return &ImportRepository{db: db}
+}
+
+// CreateImport queues the import unless the user has one pending or running.
+// The user is locked meanwhile, so concurrent uploads queue a single import.
+func (r *ImportRepository) CreateImport(ctx context.Context, dataImport *model.DataImport) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockUser
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("user_id").
+			Where("user_id = ?", dataImport.UserID).
+			First(&model.User{}).Error; err != nil {
+			return err
+		}
+
+		// CheckActiveImport
+		var count int64
+		if err := tx.Model(&model.DataImport{}).
+			Where("user_id = ? AND status IN ?", dataImport.UserID, []string{model.ImportPending, model.ImportRunning}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		// CreateImport
+		created = true
+		return tx.Create(dataImport).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (r *ImportRepository) GetImport(ctx context.Context, userID, importID int) (*model.DataImport, error) {
+	var dataImport model.DataImport
+	if err := r.db.WithContext(ctx).
+		Preload("Failures", func(db *gorm.DB) *gorm.DB {
+			return db.Order("import_failure_id")
+		}).
+		Where("data_import_id = ? AND user_id = ?", importID, userID).
+		First(&dataImport).Error; err != nil {
+		return nil, err
+	}
+	return &dataImport, nil
+}
+
+func (r *ImportRepository) HasActiveImport(ctx context.Context, userID int) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.DataImport{}).
+		Where("user_id = ? AND status IN ?", userID, []string{model.ImportPending, model.ImportRunning}).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// StartImport marks the pending import as running. An import that already
+// started returns gorm.ErrRecordNotFound.
+func (r *ImportRepository) StartImport(ctx context.Context, importID int) (*model.DataImport, error) {
+	var dataImport model.DataImport
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockImport
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("data_import_id = ? AND status = ?", importID, model.ImportPending).
+			First(&dataImport).Error; err != nil {
+			return err
+		}
+
+		// StartImport
+		now := time.Now()
+		dataImport.Status = model.ImportRunning
+		dataImport.StartedAt = &now
+		dataImport.HeartbeatAt = &now
+		return tx.Model(&dataImport).Updates(map[string]interface{}{
+			"status":       dataImport.Status,
+			"started_at":   now,
+			"heartbeat_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dataImport, nil
+}
+
+// FailStaleImports fails imports whose worker stopped sending heartbeats before
+// staleBefore. They are not retried since the posts created before the crash
+// would be duplicated.
+func (r *ImportRepository) FailStaleImports(ctx context.Context, staleBefore time.Time, reason string) error {
+	return r.db.WithContext(ctx).Model(&model.DataImport{}).
+		Where("status = ? AND COALESCE(heartbeat_at, started_at) < ?", model.ImportRunning, staleBefore).
+		Updates(map[string]interface{}{
+			"status":       model.ImportFailed,
+			"error":        reason,
+			"completed_at": time.Now(),
+		}).Error
+}
+
+// FailImport fails a pending import before it started.
+func (r *ImportRepository) FailImport(ctx context.Context, importID int, reason string) error {
+	return r.db.WithContext(ctx).Model(&model.DataImport{}).
+		Where("data_import_id = ? AND status = ?", importID, model.ImportPending).
+		Updates(map[string]interface{}{
+			"status":       model.ImportFailed,
+			"error":        reason,
+			"completed_at": time.Now(),
+		}).Error
+}
+
+// GetActiveImportFiles returns the uploads of imports yet to finish.
+func (r *ImportRepository) GetActiveImportFiles(ctx context.Context) ([]string, error) {
+	var files []string
+	if err := r.db.WithContext(ctx).Model(&model.DataImport{}).
+		Where("status IN ?", []string{model.ImportPending, model.ImportRunning}).
+		Pluck("file", &files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *ImportRepository) AddImportFailures(ctx context.Context, failures []model.ImportFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).CreateInBatches(failures, 100).Error
+}
+
+// Heartbeat records the progress of a running import. It returns
+// gorm.ErrRecordNotFound once the import is no longer running.
+func (r *ImportRepository) Heartbeat(ctx context.Context, dataImport *model.DataImport) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(dataImport).
+		Where("status = ?", model.ImportRunning).
+		Updates(map[string]interface{}{
+			"format":       dataImport.Format,
+			"total":        dataImport.Total,
+			"imported":     dataImport.Imported,
+			"heartbeat_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	dataImport.HeartbeatAt = &now
+	return nil
+}
+
+// FinishImport stores the final status and counters of a running import, one
+// failed as stale meanwhile keeps its status.
+func (r *ImportRepository) FinishImport(ctx context.Context, dataImport *model.DataImport) error {
+	now := time.Now()
+	dataImport.CompletedAt = &now
+	return r.db.WithContext(ctx).Model(dataImport).Where("status = ?", model.ImportRunning).Updates(map[string]interface{}{
+		"status":       dataImport.Status,
+		"format":       dataImport.Format,
+		"error":        dataImport.Error,
+		"total":        dataImport.Total,
+		"imported":     dataImport.Imported,
+		"failed":       dataImport.Failed,
+		"completed_at": now,
+	}).Error
+}
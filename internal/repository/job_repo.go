@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// CreateJob queues the job. A job with the unique key of an existing one is
+// skipped, leaving its ID unset.
+func (r *JobRepository) CreateJob(ctx context.Context, job *model.Job) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(job).Error
+}
+
+// ClaimJobs marks up to limit due jobs of the queue as running until the lease
+// expires. Jobs left running by a crashed worker are claimed again after it.
+func (r *JobRepository) ClaimJobs(ctx context.Context, queue string, limit int, lease time.Duration) ([]model.Job, error) {
+	var jobs []model.Job
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockJobs
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("queue = ? AND status IN ? AND run_at <= ?", queue, []string{model.JobPending, model.JobRunning}, now).
+			Order("run_at").
+			Limit(limit).
+			Find(&jobs).Error; err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		// StartJobs
+		ids := make([]int64, 0, len(jobs))
+		for i := range jobs {
+			ids = append(ids, jobs[i].JobID)
+			jobs[i].Status = model.JobRunning
+			jobs[i].Attempts++
+			jobs[i].RunAt = now.Add(lease)
+			jobs[i].StartedAt = &now
+		}
+		return tx.Model(&model.Job{}).Where("job_id IN ?", ids).Updates(map[string]interface{}{
+			"status":     model.JobRunning,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"run_at":     now.Add(lease),
+			"started_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// SaveJob stores the state of a job after an attempt.
+func (r *JobRepository) SaveJob(ctx context.Context, job *model.Job) error {
+	return r.db.WithContext(ctx).Model(job).Updates(map[string]interface{}{
+		"status":       job.Status,
+		"attempts":     job.Attempts,
+		"run_at":       job.RunAt,
+		"last_error":   job.LastError,
+		"completed_at": job.CompletedAt,
+	}).Error
+}
+
+// RequeueDeadJobs gives the dead jobs of the queue, or of every queue if
+// empty, a new series of attempts.
+func (r *JobRepository) RequeueDeadJobs(ctx context.Context, queue string) (int64, error) {
+	query := r.db.WithContext(ctx).Model(&model.Job{}).Where("status = ?", model.JobDead)
+	if queue != "" {
+		query = query.Where("queue = ?", queue)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":       model.JobPending,
+		"attempts":     0,
+		"run_at":       time.Now(),
+		"completed_at": nil,
+	})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteFinishedJobs removes jobs that succeeded before succeededBefore and
+// dead jobs that died before deadBefore.
+func (r *JobRepository) DeleteFinishedJobs(ctx context.Context, succeededBefore, deadBefore time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("(status = ? AND completed_at < ?) OR (status = ? AND completed_at < ?)", model.JobSucceeded, succeededBefore, model.JobDead, deadBefore).
+		Delete(&model.Job{}).Error
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MFARepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+func (r *MFARepository) GetTOTP(ctx context.Context, userID int) (*model.TOTP, error) {
+	var totp model.TOTP
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&totp).Error; err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// SaveTOTPSecret starts (or restarts) an enrollment, unless TOTP is already enabled.
+func (r *MFARepository) SaveTOTPSecret(ctx context.Context, userID int, secret string) error {
+	totp := &model.TOTP{UserID: userID, Secret: secret}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"secret": secret, "last_used_step": 0}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "totps.enabled = false"}}},
+	}).Create(totp).Error
+}
+
+// EnableTOTP marks the enrollment confirmed and replaces the recovery codes.
+func (r *MFARepository) EnableTOTP(ctx context.Context, userID int, step int64, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// EnableTOTP
+		if err := tx.Model(&model.TOTP{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"enabled":        true,
+			"last_used_step": step,
+			"confirmed_at":   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// ReplaceRecoveryCodes
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.RecoveryCode, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *MFARepository) DisableTOTP(ctx context.Context, userID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.TOTP{}).Error
+	})
+}
+
+// UseTOTPStep advances the last used step, false when the step was already used.
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.TOTP{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code, false when there is none.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
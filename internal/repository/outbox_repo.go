@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// outboxLockKey is the advisory lock serializing claims between relays, so
+// events of an aggregate are never claimed out of order.
+const outboxLockKey = 7351902461
+
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// recordEvents adds the events to the outbox, in the transaction of the change
+// they describe so they are recorded if and only if it commits.
+func recordEvents(tx *gorm.DB, events ...model.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	rows := make([]model.OutboxEvent, 0, len(events))
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		aggregateType, aggregateID := event.Aggregate()
+		rows = append(rows, model.OutboxEvent{
+			AggregateType: aggregateType,
+			AggregateID:   aggregateID,
+			Type:          event.EventType(),
+			Payload:       string(payload),
+			Status:        model.OutboxPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	return tx.CreateInBatches(&rows, 500).Error
+}
+
+// ClaimEvents returns up to limit due events in the order they were recorded
+// and postpones them by lease, so a crashed relay's events are dispatched
+// again after it. An event waits while an earlier one of its aggregate is
+// claimed or waiting for a retry.
+func (r *OutboxRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockRelays
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", outboxLockKey).Error; err != nil {
+			return err
+		}
+
+		// SelectEvents
+		now := time.Now()
+		if err := tx.Where("status = ? AND next_attempt_at <= ?", model.OutboxPending, now).
+			Where(`NOT EXISTS (SELECT 1 FROM outbox_events earlier
+				WHERE earlier.aggregate_type = outbox_events.aggregate_type AND earlier.aggregate_id = outbox_events.aggregate_id
+				AND earlier.outbox_event_id < outbox_events.outbox_event_id AND earlier.status = ? AND earlier.next_attempt_at > ?)`, model.OutboxPending, now).
+			Order("outbox_event_id").
+			Limit(limit).
+			Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		// PostponeEvents
+		ids := make([]int64, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.OutboxEventID)
+		}
+		return tx.Model(&model.OutboxEvent{}).Where("outbox_event_id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkProcessed(ctx context.Context, eventID int64) error {
+	return r.db.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("outbox_event_id = ?", eventID).
+		Updates(map[string]interface{}{"status": model.OutboxProcessed, "processed_at": time.Now()}).Error
+}
+
+// SaveFailure records a failed dispatch with the event's new state.
+func (r *OutboxRepository) SaveFailure(ctx context.Context, event *model.OutboxEvent) error {
+	return r.db.WithContext(ctx).Model(event).Updates(map[string]interface{}{
+		"status":          event.Status,
+		"attempts":        event.Attempts,
+		"last_error":      event.LastError,
+		"next_attempt_at": event.NextAttemptAt,
+		"processed_at":    event.ProcessedAt,
+	}).Error
+}
+
+// DeleteProcessedEvents removes events dispatched or given up on before the time.
+func (r *OutboxRepository) DeleteProcessedEvents(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("status <> ? AND processed_at < ?", model.OutboxPending, before).
+		Delete(&model.OutboxEvent{}).Error
+}
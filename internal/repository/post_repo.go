@@ -1,10 +1,11 @@
 package repository
 
 import (
-	"errors"
+	"context"
 	"x-clone/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PostRepository struct {
@@ -15,16 +16,41 @@ func NewPostRepository(db *gorm.DB) *PostRepository {
 	return &PostRepository{db: db}
 }
 
-func (r *PostRepository) CreatePost(post *model.Post) (*model.Post, error) {
-	if err := r.db.Create(post).Error; err != nil {
+func (r *PostRepository) CreatePost(ctx context.Context, post *model.Post) (*model.Post, error) {
+	if err := r.createPost(ctx, post, false); err != nil {
 		return nil, err
 	}
 	return post, nil
 }
 
-func (r *PostRepository) GetUserPosts(userID int) (*[]model.Post, error) {
+// ImportPost creates a post restored from an archive.
+func (r *PostRepository) ImportPost(ctx context.Context, post *model.Post) (*model.Post, error) {
+	if err := r.createPost(ctx, post, true); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (r *PostRepository) createPost(ctx context.Context, post *model.Post, imported bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// CreatePost
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+
+		// RecordEvent
+		return recordEvents(tx, model.PostCreated{
+			PostID:         post.PostID,
+			UserID:         post.UserID,
+			OriginalPostID: post.OriginalPostID,
+			Imported:       imported,
+		})
+	})
+}
+
+func (r *PostRepository) GetUserPosts(ctx context.Context, userID int) (*[]model.Post, error) {
 	var posts []model.Post
-	if err := r.db.Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
+	if err := r.db.WithContext(ctx).Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
 		return db.Preload("OriginalPost") // Recursive preload OriginalPost *Post
 	}).Where("user_id = ?", userID).Find(&posts).Error; err != nil {
 		return nil, err
@@ -32,9 +58,9 @@ func (r *PostRepository) GetUserPosts(userID int) (*[]model.Post, error) {
 	return &posts, nil
 }
 
-func (r *PostRepository) GetUserPostByID(userID, postID int) (*model.Post, error) {
+func (r *PostRepository) GetUserPostByID(ctx context.Context, userID, postID int) (*model.Post, error) {
 	var post model.Post
-	if err := r.db.Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
+	if err := r.db.WithContext(ctx).Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
 		return db.Preload("OriginalPost") // Recursive preload OriginalPost *Post
 	}).Where("user_id = ? AND post_id = ?", userID, postID).First(&post).Error; err != nil {
 		return nil, err
@@ -42,10 +68,18 @@ func (r *PostRepository) GetUserPostByID(userID, postID int) (*model.Post, error
 	return &post, nil
 }
 
-func (r *PostRepository) UpdatePostContentByID(userID, postID int, content string) (*model.Post, error) {
+func (r *PostRepository) GetPostByID(ctx context.Context, postID int) (*model.Post, error) {
+	var post model.Post
+	if err := r.db.WithContext(ctx).Where("post_id = ?", postID).First(&post).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (r *PostRepository) UpdatePostContentByID(ctx context.Context, userID, postID int, content string) (*model.Post, error) {
 	var post model.Post
 
-	if err := r.db.Transaction(func(tx *gorm.DB) error {
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&model.Post{}).
 			Where("user_id = ? AND post_id = ?", userID, postID).
 			Update("content", content).
@@ -60,151 +94,171 @@ func (r *PostRepository) UpdatePostContentByID(userID, postID int, content strin
 	return &post, nil
 }
 
-func (r *PostRepository) DeletePostByID(userID, postID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// Deleting all reposts associated with this post
-		if err := tx.Where("reposted_post_id = ?", postID).Delete(&model.Repost{}).Error; err != nil {
-			return err
-		}
+func (r *PostRepository) DeletePostByID(ctx context.Context, userID, postID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deletePost(tx, userID, postID)
+	})
+}
 
-		// Deleting all likes associated with this post
-		if err := tx.Where("liked_post_id = ?", postID).Delete(&model.Like{}).Error; err != nil {
-			return err
-		}
+// deletePost removes the user's post with its reposts, likes and quotes, all
+// in the caller's transaction.
+func deletePost(tx *gorm.DB, userID, postID int) error {
+	// LockPost, posts of other users are left untouched
+	var post model.Post
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("post_id").
+		Where("user_id = ? AND post_id = ?", userID, postID).
+		Limit(1).
+		Find(&post)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
 
-		// Deleting all quotes asscodiated with this post
-		var quotes []model.Post
-		if err := tx.Where("original_post_id = ?", postID).Find(&quotes).Error; err != nil {
-			return err
-		}
-		for _, quote := range quotes {
-			if err := r.DeletePostByID(quote.UserID, quote.PostID); err != nil {
-				return err
-			}
-		}
+	// Deleting all reposts associated with this post
+	if err := tx.Where("reposted_post_id = ?", postID).Delete(&model.Repost{}).Error; err != nil {
+		return err
+	}
 
-		// Deleting the post itself
-		if err := tx.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&model.Post{}).Error; err != nil {
+	// Deleting all likes associated with this post
+	if err := tx.Where("liked_post_id = ?", postID).Delete(&model.Like{}).Error; err != nil {
+		return err
+	}
+
+	// Deleting all quotes asscodiated with this post
+	var quotes []model.Post
+	if err := tx.Where("original_post_id = ?", postID).Find(&quotes).Error; err != nil {
+		return err
+	}
+	for _, quote := range quotes {
+		if err := deletePost(tx, quote.UserID, quote.PostID); err != nil {
 			return err
 		}
+	}
 
-		return nil
-	})
-}
+	// Deleting the post itself
+	if err := tx.Where("post_id = ?", postID).Delete(&model.Post{}).Error; err != nil {
+		return err
+	}
 
-func (r *PostRepository) LikePost(userID, postID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsLiked
-		var existingLike model.Like
-		if err := tx.Where("user_id = ? AND liked_post_id = ?", userID, postID).First(&existingLike).Error; err != nil {
-			if err != gorm.ErrRecordNotFound {
-				return err
-			}
-		} else {
-			return errors.New("you have already liked this post")
-		}
+	return recordEvents(tx, model.PostDeleted{PostID: postID, UserID: userID})
+}
 
+func (r *PostRepository) LikePost(ctx context.Context, userID, postID int) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// CreateLike
 		like := &model.Like{
 			UserID:      userID,
 			LikedPostID: postID,
 		}
-		if err := tx.Create(like).Error; err != nil {
-			return err
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(like)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Already liked
 		}
 
 		// IncrementLikes
-		if err := tx.Model(&model.Post{}).Where("post_id = ?", postID).Update("likes", gorm.Expr("likes + 1")).Error; err != nil {
+		author, err := updateCounter(tx, postID, "likes", gorm.Expr("likes + 1"))
+		if err != nil {
 			return err
 		}
 
+		// RecordEvent
+		if err := recordEvents(tx, model.PostLiked{PostID: postID, AuthorID: author, UserID: userID}); err != nil {
+			return err
+		}
+
+		created = true
 		return nil
 	})
+	return created, err
 }
 
-func (r *PostRepository) UnlikePost(userID, postID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsLiked
-		var existingLike model.Like
-		if err := tx.Where("user_id = ? AND liked_post_id = ?", userID, postID).First(&existingLike).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return errors.New("you have already unliked this post")
-			}
-			return err
-		}
-
+func (r *PostRepository) UnlikePost(ctx context.Context, userID, postID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// DeleteLike
-		if err := tx.Delete(&existingLike).Error; err != nil {
-			return err
+		result := tx.Where("user_id = ? AND liked_post_id = ?", userID, postID).Delete(&model.Like{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Not liked
 		}
 
 		// DecrementLikes
-		if err := tx.Model(&model.Post{}).Where("post_id = ?", postID).Update("likes", gorm.Expr("likes - 1")).Error; err != nil {
+		author, err := updateCounter(tx, postID, "likes", gorm.Expr("likes - 1"))
+		if err != nil {
 			return err
 		}
 
-		return nil
+		// RecordEvent
+		return recordEvents(tx, model.PostUnliked{PostID: postID, AuthorID: author, UserID: userID})
 	})
 }
 
-func (r *PostRepository) RepostPost(userID, postID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsReposted
-		var existingRepost model.Repost
-		if err := tx.Where("user_id = ? AND reposted_post_id = ?", userID, postID).First(&existingRepost).Error; err != nil {
-			if err != gorm.ErrRecordNotFound {
-				return err
-			}
-		} else {
-			return errors.New("you have already reposted this post")
-		}
-
+func (r *PostRepository) RepostPost(ctx context.Context, userID, postID int) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// CreateRepost
 		repost := &model.Repost{
 			UserID:         userID,
 			RepostedPostID: postID,
 		}
-		if err := tx.Create(repost).Error; err != nil {
-			return err
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(repost)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Already reposted
 		}
 
 		// IncrementReposts
-		if err := tx.Model(&model.Post{}).Where("post_id = ?", postID).Update("reposts", gorm.Expr("reposts + 1")).Error; err != nil {
+		author, err := updateCounter(tx, postID, "reposts", gorm.Expr("reposts + 1"))
+		if err != nil {
 			return err
 		}
 
+		// RecordEvent
+		if err := recordEvents(tx, model.PostReposted{PostID: postID, AuthorID: author, UserID: userID}); err != nil {
+			return err
+		}
+
+		created = true
 		return nil
 	})
+	return created, err
 }
 
-func (r *PostRepository) UndoRepostPost(userID, postID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsReposted
-		var existingRepost model.Repost
-		if err := tx.Where("user_id = ? AND reposted_post_id = ?", userID, postID).First(&existingRepost).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return errors.New("you have already cancelled repost this post")
-			}
-			return err
-		}
-
+func (r *PostRepository) UndoRepostPost(ctx context.Context, userID, postID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// DeleteRepost
-		if err := tx.Delete(&existingRepost).Error; err != nil {
-			return err
+		result := tx.Where("user_id = ? AND reposted_post_id = ?", userID, postID).Delete(&model.Repost{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Not reposted
 		}
 
 		// DecrementReposts
-		if err := tx.Model(&model.Post{}).Where("post_id = ?", postID).Update("reposts", gorm.Expr("reposts - 1")).Error; err != nil {
+		author, err := updateCounter(tx, postID, "reposts", gorm.Expr("reposts - 1"))
+		if err != nil {
 			return err
 		}
 
-		return nil
+		// RecordEvent
+		return recordEvents(tx, model.PostUnreposted{PostID: postID, AuthorID: author, UserID: userID})
 	})
 }
 
-func (r *PostRepository) GetUserReposts(userID int) (*[]model.Post, error) {
+func (r *PostRepository) GetUserReposts(ctx context.Context, userID int) (*[]model.Post, error) {
 	var reposts []model.Repost
-	if err := r.db.Where("user_id = ?", userID).Find(&reposts).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&reposts).Error; err != nil {
 		return nil, err
 	}
 
@@ -214,26 +268,26 @@ func (r *PostRepository) GetUserReposts(userID int) (*[]model.Post, error) {
 	}
 
 	var posts []model.Post
-	if err := r.db.Where("post_id IN ?", postIDs).Find(&posts).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("post_id IN ?", postIDs).Find(&posts).Error; err != nil {
 		return nil, err
 	}
 
 	return &posts, nil
 }
 
-func (r *PostRepository) QuotePost(userID, postID int, content string) (*model.Post, error) {
+func (r *PostRepository) QuotePost(ctx context.Context, userID, postID int, content string) (*model.Post, error) {
 	post := &model.Post{
 		UserID:         userID,
 		Content:        content,
 		OriginalPostID: &postID,
 	}
 
-	if err := r.db.Create(post).Error; err != nil {
+	if err := r.createPost(ctx, post, false); err != nil {
 		return nil, err
 	}
 
 	var quotedPost model.Post
-	if err := r.db.Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
+	if err := r.db.WithContext(ctx).Preload("OriginalPost", func(db *gorm.DB) *gorm.DB {
 		return db.Preload("OriginalPost") // Recursive preload OriginalPost *Post
 	}).Where("post_id = ?", post.PostID).First(&quotedPost).Error; err != nil {
 		return nil, err
@@ -241,3 +295,15 @@ func (r *PostRepository) QuotePost(userID, postID int, content string) (*model.P
 
 	return &quotedPost, nil
 }
+
+// updateCounter sets a counter of the post and returns the post's author.
+func updateCounter(tx *gorm.DB, postID int, column string, value clause.Expr) (int, error) {
+	var post model.Post
+	if err := tx.Model(&post).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "user_id"}}}).
+		Where("post_id = ?", postID).
+		Update(column, value).Error; err != nil {
+		return 0, err
+	}
+	return post.UserID, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *SessionRepository) GetActiveSession(ctx context.Context, sessionID string, userID int) (*model.Session, error) {
+	var session model.Session
+	if err := r.db.WithContext(ctx).
+		Where("session_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) GetActiveSessions(ctx context.Context, userID int) ([]model.Session, error) {
+	var sessions []model.Session
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) TouchSession(ctx context.Context, sessionID string, lastSeenAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("session_id = ?", sessionID).
+		Update("last_seen_at", lastSeenAt).Error
+}
+
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	result := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("session_id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions revokes every active session of the user except keepSessionID.
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID int, keepSessionID string) error {
+	return r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now()).Error
+}
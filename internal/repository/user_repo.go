@@ -1,10 +1,12 @@
 package repository
 
 import (
-	"errors"
+	"context"
+	"time"
 	"x-clone/internal/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -15,43 +17,44 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) GetUserByID(userID int) (*model.User, error) {
+func (r *UserRepository) GetUserByID(ctx context.Context, userID int) (*model.User, error) {
 	var user model.User
-	if err := r.db.Where("user_id = ?", userID).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *UserRepository) FindUserByUsername(username string) (*model.User, error) {
+func (r *UserRepository) FindUserByUsername(ctx context.Context, username string) (*model.User, error) {
 	var user model.User
-	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-func (r *UserRepository) FollowUser(followerID, followingID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsFollowing
-		var existingFollower model.Follower
-		if err := tx.Where("follower_id = ? AND following_id = ?", followerID, followingID).First(&existingFollower).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				// Continuing transaction...
-			} else {
-				return err
-			}
-		} else {
-			return errors.New("you are already following this user")
-		}
+func (r *UserRepository) FindUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var user model.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 
+func (r *UserRepository) FollowUser(ctx context.Context, followerID, followingID int) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// CreateFollower
 		follower := &model.Follower{
 			FollowerID:  followerID,
 			FollowingID: followingID,
 		}
-		if err := tx.Create(follower).Error; err != nil {
-			return err
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(follower)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Already following
 		}
 
 		// IncrementFollowers
@@ -63,24 +66,26 @@ func (r *UserRepository) FollowUser(followerID, followingID int) error {
 			return err
 		}
 
+		// RecordEvent
+		if err := recordEvents(tx, model.UserFollowed{FollowerID: followerID, FollowingID: followingID}); err != nil {
+			return err
+		}
+
+		created = true
 		return nil
 	})
+	return created, err
 }
 
-func (r *UserRepository) StopFollowingUser(followerID, followingID int) error {
-	return r.db.Transaction(func(tx *gorm.DB) error {
-		// IsFollowing
-		var existingFollower model.Follower
-		if err := tx.Where("follower_id = ? AND following_id = ?", followerID, followingID).First(&existingFollower).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return errors.New("you are not following this user")
-			}
-			return err
-		}
-
+func (r *UserRepository) StopFollowingUser(ctx context.Context, followerID, followingID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// DeleteFollower
-		if err := tx.Delete(&existingFollower).Error; err != nil {
-			return err
+		result := tx.Where("follower_id = ? AND following_id = ?", followerID, followingID).Delete(&model.Follower{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil // Not following
 		}
 
 		// DecrementFollowers
@@ -92,15 +97,16 @@ func (r *UserRepository) StopFollowingUser(followerID, followingID int) error {
 			return err
 		}
 
-		return nil
+		// RecordEvent
+		return recordEvents(tx, model.UserUnfollowed{FollowerID: followerID, FollowingID: followingID})
 	})
 }
 
-func (r *UserRepository) GetFollowersByUser(userID int) ([]model.User, error) {
+func (r *UserRepository) GetFollowersByUser(ctx context.Context, userID int) ([]model.User, error) {
 	var user model.User
 
-	err := r.db.
-		Preload("FollowersList").
+	err := r.db.WithContext(ctx).
+		Preload("FollowersList", "deactivated_at IS NULL AND deletion_requested_at IS NULL").
 		Where("user_id = ?", userID).
 		First(&user).Error
 
@@ -111,11 +117,11 @@ func (r *UserRepository) GetFollowersByUser(userID int) ([]model.User, error) {
 	return user.FollowersList, nil
 }
 
-func (r *UserRepository) GetFollowingByUser(userID int) ([]model.User, error) {
+func (r *UserRepository) GetFollowingByUser(ctx context.Context, userID int) ([]model.User, error) {
 	var user model.User
 
-	err := r.db.
-		Preload("FollowingList").
+	err := r.db.WithContext(ctx).
+		Preload("FollowingList", "deactivated_at IS NULL AND deletion_requested_at IS NULL").
 		Where("user_id = ?", userID).
 		First(&user).Error
 
@@ -126,16 +132,111 @@ func (r *UserRepository) GetFollowingByUser(userID int) ([]model.User, error) {
 	return user.FollowingList, nil
 }
 
-func (r *UserRepository) ProfileUpdate(userID int, updates map[string]interface{}) (*model.User, error) {
+func (r *UserRepository) GetFollowerIDs(ctx context.Context, userID int) ([]int, error) {
+	var followerIDs []int
+	if err := r.db.WithContext(ctx).Model(&model.Follower{}).
+		Where("following_id = ?", userID).
+		Pluck("follower_id", &followerIDs).Error; err != nil {
+		return nil, err
+	}
+	return followerIDs, nil
+}
+
+func (r *UserRepository) ProfileUpdate(ctx context.Context, userID int, updates map[string]interface{}) (*model.User, error) {
 	var user model.User
 
-	if err := r.db.Model(&user).Where("user_id = ?", userID).Updates(updates).First(&user).Error; err != nil {
+	if err := r.db.WithContext(ctx).Model(&user).Where("user_id = ?", userID).Updates(updates).First(&user).Error; err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
 
-func (r *UserRepository) PasswordChange(userID int, hashedNewPassword string) error {
-	return r.db.Model(&model.User{}).Where("user_id = ?", userID).Update("password", hashedNewPassword).Error
+func (r *UserRepository) PasswordChange(ctx context.Context, userID int, hashedNewPassword string) error {
+	return r.db.WithContext(ctx).Model(&model.User{}).Where("user_id = ?", userID).Update("password", hashedNewPassword).Error
+}
+
+// PasswordChangeSignOut sets the password and revokes the user's sessions
+// except keepSessionID, along with their personal access tokens.
+func (r *UserRepository) PasswordChangeSignOut(ctx context.Context, userID int, hashedNewPassword, keepSessionID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// UpdatePassword
+		if err := tx.Model(&model.User{}).Where("user_id = ?", userID).Update("password", hashedNewPassword).Error; err != nil {
+			return err
+		}
+
+		// RevokeSessions
+		now := time.Now()
+		if err := tx.Model(&model.Session{}).
+			Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		// RevokeAccessTokens
+		return tx.Model(&model.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+}
+
+func (r *UserRepository) IsFollowing(ctx context.Context, followerID, followingID int) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.Follower{}).
+		Where("follower_id = ? AND following_id = ?", followerID, followingID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BlockUser blocks the user and removes follows between the two in both directions.
+func (r *UserRepository) BlockUser(ctx context.Context, blockerID, blockedID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// CreateBlock
+		block := &model.Block{
+			BlockerID: blockerID,
+			BlockedID: blockedID,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error; err != nil {
+			return err
+		}
+
+		// DeleteFollowers
+		for _, pair := range [][2]int{{blockerID, blockedID}, {blockedID, blockerID}} {
+			result := tx.Where("follower_id = ? AND following_id = ?", pair[0], pair[1]).Delete(&model.Follower{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue // Not following
+			}
+			if err := tx.Model(&model.User{}).Where("user_id = ?", pair[1]).Update("followers", gorm.Expr("followers - 1")).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&model.User{}).Where("user_id = ?", pair[0]).Update("following", gorm.Expr("following - 1")).Error; err != nil {
+				return err
+			}
+			if err := recordEvents(tx, model.UserUnfollowed{FollowerID: pair[0], FollowingID: pair[1]}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *UserRepository) UnblockUser(ctx context.Context, blockerID, blockedID int) error {
+	return r.db.WithContext(ctx).Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&model.Block{}).Error
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (r *UserRepository) IsBlocked(ctx context.Context, userID, otherID int) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&model.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID, otherID, otherID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
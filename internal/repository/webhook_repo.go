@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateWebhook adds the webhook unless the user has maxPerUser already. The
+// user is locked meanwhile, so concurrent requests cannot exceed the limit.
+func (r *WebhookRepository) CreateWebhook(ctx context.Context, webhook *model.Webhook, maxPerUser int) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// LockUser
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("user_id").
+			Where("user_id = ?", webhook.UserID).
+			First(&model.User{}).Error; err != nil {
+			return err
+		}
+
+		// CountWebhooks
+		var count int64
+		if err := tx.Model(&model.Webhook{}).Where("user_id = ?", webhook.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) >= maxPerUser {
+			return nil
+		}
+
+		// CreateWebhook
+		created = true
+		return tx.Create(webhook).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+func (r *WebhookRepository) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) GetWebhook(ctx context.Context, userID, webhookID int) (*model.Webhook, error) {
+	var webhook model.Webhook
+	if err := r.db.WithContext(ctx).Where("webhook_id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetActiveWebhooks returns the user's webhooks that are not disabled.
+func (r *WebhookRepository) GetActiveWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND disabled_at IS NULL", userID).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhooksByIDs maps webhook IDs to webhooks.
+func (r *WebhookRepository) GetWebhooksByIDs(ctx context.Context, webhookIDs []int) (map[int]*model.Webhook, error) {
+	var webhooks []model.Webhook
+	if err := r.db.WithContext(ctx).Where("webhook_id IN ?", webhookIDs).Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*model.Webhook, len(webhooks))
+	for i := range webhooks {
+		byID[webhooks[i].WebhookID] = &webhooks[i]
+	}
+	return byID, nil
+}
+
+// UpdateWebhook applies the updates. Disabling fails the pending deliveries,
+// enabling clears the failure count.
+func (r *WebhookRepository) UpdateWebhook(ctx context.Context, webhook *model.Webhook, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// UpdateWebhook
+		if err := tx.Model(webhook).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// FailPendingDeliveries
+		if disabledAt, ok := updates["disabled_at"]; ok && disabledAt != nil {
+			return failPendingDeliveries(tx, webhook.WebhookID)
+		}
+		return nil
+	})
+}
+
+func (r *WebhookRepository) DeleteWebhook(ctx context.Context, userID, webhookID int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// DeleteWebhook
+		result := tx.Where("webhook_id = ? AND user_id = ?", webhookID, userID).Delete(&model.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// DeleteDeliveries
+		return deleteDeliveries(tx, "webhook_id = ?", webhookID)
+	})
+}
+
+// CreateDeliveries queues the deliveries. A delivery of a domain event already
+// queued for the webhook is skipped, leaving its ID unset.
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range deliveries {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *WebhookRepository) GetDelivery(ctx context.Context, deliveryID int) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	if err := r.db.WithContext(ctx).Where("webhook_delivery_id = ?", deliveryID).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// DeleteDeliveries removes the deliveries with their attempts.
+func (r *WebhookRepository) DeleteDeliveries(ctx context.Context, deliveryIDs []int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteDeliveries(tx, "webhook_delivery_id IN ?", deliveryIDs)
+	})
+}
+
+// SaveAttempt records the attempt with the delivery's new state. A succeeded
+// delivery resets the webhook's failure count, a failed one increments it and
+// disables the webhook at disableAfter. A disableAfter of 0 leaves failures
+// uncounted.
+func (r *WebhookRepository) SaveAttempt(ctx context.Context, delivery *model.WebhookDelivery, attempt *model.WebhookAttempt, disableAfter int) (bool, error) {
+	disabled := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// CreateAttempt
+		attempt.WebhookDeliveryID = delivery.WebhookDeliveryID
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+
+		// UpdateDelivery
+		if err := tx.Model(delivery).Updates(map[string]interface{}{
+			"status":          delivery.Status,
+			"attempts":        delivery.Attempts,
+			"next_attempt_at": delivery.NextAttemptAt,
+			"completed_at":    delivery.CompletedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		// UpdateWebhook
+		switch delivery.Status {
+		case model.DeliverySucceeded:
+			return tx.Model(&model.Webhook{}).
+				Where("webhook_id = ? AND consecutive_failures > 0", delivery.WebhookID).
+				Update("consecutive_failures", 0).Error
+		case model.DeliveryFailed:
+			if disableAfter == 0 {
+				return nil
+			}
+			if err := tx.Model(&model.Webhook{}).
+				Where("webhook_id = ?", delivery.WebhookID).
+				Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+				return err
+			}
+			result := tx.Model(&model.Webhook{}).
+				Where("webhook_id = ? AND consecutive_failures >= ? AND disabled_at IS NULL", delivery.WebhookID, disableAfter).
+				Update("disabled_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			disabled = true
+			return failPendingDeliveries(tx, delivery.WebhookID)
+		}
+		return nil
+	})
+	return disabled, err
+}
+
+// FailDelivery gives up on a delivery without attempting it.
+func (r *WebhookRepository) FailDelivery(ctx context.Context, deliveryID int) error {
+	return r.db.WithContext(ctx).Model(&model.WebhookDelivery{}).
+		Where("webhook_delivery_id = ?", deliveryID).
+		Updates(map[string]interface{}{"status": model.DeliveryFailed, "completed_at": time.Now()}).Error
+}
+
+func failPendingDeliveries(tx *gorm.DB, webhookID int) error {
+	return tx.Model(&model.WebhookDelivery{}).
+		Where("webhook_id = ? AND status = ?", webhookID, model.DeliveryPending).
+		Updates(map[string]interface{}{"status": model.DeliveryFailed, "completed_at": time.Now()}).Error
+}
+
+// GetDeliveries returns a page of the webhook's deliveries before beforeID
+// with their attempts, newest first.
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, webhookID, beforeID, limit int) ([]model.WebhookDelivery, error) {
+	query := r.db.WithContext(ctx).
+		Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+			return db.Order("attempted_at")
+		}).
+		Where("webhook_id = ?", webhookID)
+	if beforeID > 0 {
+		query = query.Where("webhook_delivery_id < ?", beforeID)
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := query.Order("webhook_delivery_id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// DeleteCompletedDeliveries removes deliveries that completed before the time.
+func (r *WebhookRepository) DeleteCompletedDeliveries(ctx context.Context, before time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteDeliveries(tx, "status <> ? AND completed_at < ?", model.DeliveryPending, before)
+	})
+}
+
+// deleteDeliveries removes the deliveries matching the condition with their attempts.
+func deleteDeliveries(tx *gorm.DB, query string, args ...interface{}) error {
+	deliveries := tx.Model(&model.WebhookDelivery{}).Select("webhook_delivery_id").Where(query, args...)
+	if err := tx.Where("webhook_delivery_id IN (?)", deliveries).Delete(&model.WebhookAttempt{}).Error; err != nil {
+		return err
+	}
+	return tx.Where(query, args...).Delete(&model.WebhookDelivery{}).Error
+}
@@ -3,54 +3,164 @@ package router
 import (
 	"net/http"
 	"x-clone/internal/handler"
+	"x-clone/internal/model"
+	"x-clone/pkg/middleware"
+	"x-clone/pkg/problem"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Handlers struct {
-	AuthHandler *handler.AuthHandler
-	PostHandler *handler.PostHandler
-	UserHandler *handler.UserHandler
+	AuthHandler    *handler.AuthHandler
+	AccountHandler *handler.AccountHandler
+	ExportHandler  *handler.ExportHandler
+	GatewayHandler *handler.GatewayHandler
+	ImportHandler  *handler.ImportHandler
+	MessageHandler *handler.MessageHandler
+	PostHandler    *handler.PostHandler
+	StreamHandler  *handler.StreamHandler
+	UserHandler    *handler.UserHandler
+	WebhookHandler *handler.WebhookHandler
 }
 
-func New(handlers *Handlers, authMiddleware func(http.Handler) http.Handler) *chi.Mux {
+type Middlewares struct {
+	RealIP        func(http.Handler) http.Handler
+	Auth          func(scope string) func(http.Handler) http.Handler // "" accepts sessions only
+	RequestLogger func(http.Handler) http.Handler
+	RateLimit     func(policy string) func(http.Handler) http.Handler
+}
+
+func New(handlers *Handlers, middlewares *Middlewares) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middlewares.RealIP)
+	r.Use(middleware.Tracing)
+	r.Use(middlewares.RequestLogger)
+	r.Use(middleware.Metrics)
+	r.Use(middleware.Recoverer)
 
 	// Access only
 	r.Group(func(r chi.Router) {
-		r.Post("/auth/register", handlers.AuthHandler.Register())
-		r.Post("/auth/login", handlers.AuthHandler.Login())
+		r.Use(middlewares.RateLimit("default"))
+
+		r.With(middlewares.RateLimit("register")).Post("/auth/register", handlers.AuthHandler.Register())
+		r.With(middlewares.RateLimit("login")).Post("/auth/login", handlers.AuthHandler.Login())
+		r.With(middlewares.RateLimit("login")).Post("/auth/login/mfa", handlers.AuthHandler.LoginMFA())
+		r.With(middlewares.RateLimit("password_reset")).Post("/auth/password/forgot", handlers.AuthHandler.ForgotPassword())
+		r.With(middlewares.RateLimit("password_reset")).Post("/auth/password/reset", handlers.AuthHandler.ResetPassword())
+		r.Post("/auth/email/verify", handlers.AuthHandler.VerifyEmail())
 	})
 
+	// Public keys for verifying access tokens
+	r.Get("/.well-known/jwks.json", handlers.AuthHandler.JWKS())
+
+	// WebSocket gateway, authenticated on the handshake
+	r.With(middlewares.RateLimit("default")).Get("/gateway", handlers.GatewayHandler.Connect())
+
+	// Sessions only
 	r.Group(func(r chi.Router) {
-		r.Use(authMiddleware) // Apply middleware to all routers in the group
+		r.Use(middlewares.Auth("")) // Apply middleware to all routers in the group
+		r.Use(middlewares.RateLimit("default"))
 
-		// User
+		// Settings
 		r.Patch("/settings/profile", handlers.UserHandler.ProfileUpdate())
 		r.Patch("/settings/password", handlers.UserHandler.PasswordChange())
+		r.With(middlewares.RateLimit("email_verification")).Put("/settings/email", handlers.AuthHandler.ChangeEmail())
+		r.With(middlewares.RateLimit("email_verification")).Post("/settings/email/verification", handlers.AuthHandler.ResendEmailVerification())
+		r.Get("/settings/login-events", handlers.AuthHandler.GetLoginEvents())
+		r.Get("/settings/sessions", handlers.AuthHandler.GetSessions())
+		r.Delete("/settings/sessions", handlers.AuthHandler.RevokeOtherSessions())
+		r.Delete("/settings/sessions/{session_id}", handlers.AuthHandler.RevokeSession())
+		r.Get("/settings/tokens", handlers.AuthHandler.GetPersonalAccessTokens())
+		r.Post("/settings/tokens", handlers.AuthHandler.CreatePersonalAccessToken())
+		r.Delete("/settings/tokens/{token_id}", handlers.AuthHandler.RevokePersonalAccessToken())
+		r.Get("/settings/webhooks", handlers.WebhookHandler.GetWebhooks())
+		r.Post("/settings/webhooks", handlers.WebhookHandler.CreateWebhook())
+		r.Get("/settings/webhooks/{webhook_id}", handlers.WebhookHandler.GetWebhook())
+		r.Patch("/settings/webhooks/{webhook_id}", handlers.WebhookHandler.UpdateWebhook())
+		r.Delete("/settings/webhooks/{webhook_id}", handlers.WebhookHandler.DeleteWebhook())
+		r.Post("/settings/webhooks/{webhook_id}/ping", handlers.WebhookHandler.PingWebhook())
+		r.Get("/settings/webhooks/{webhook_id}/deliveries", handlers.WebhookHandler.GetDeliveries())
+		r.Post("/settings/2fa/totp", handlers.AuthHandler.EnrollTOTP())
+		r.Post("/settings/2fa/totp/confirm", handlers.AuthHandler.ConfirmTOTP())
+		r.Delete("/settings/2fa/totp", handlers.AuthHandler.DisableTOTP())
+		r.Post("/settings/account/deactivate", handlers.AccountHandler.Deactivate())
+		r.Delete("/settings/account", handlers.AccountHandler.Delete())
+		r.Post("/settings/export", handlers.ExportHandler.RequestExport())
+		r.Get("/settings/export/{export_id}", handlers.ExportHandler.GetExport())
+		r.Get("/settings/export/{export_id}/download", handlers.ExportHandler.DownloadExport())
+		r.Post("/settings/import", handlers.ImportHandler.RequestImport())
+		r.Get("/settings/import/{import_id}", handlers.ImportHandler.GetImport())
+
+		// Direct messages
+		r.Get("/conversations", handlers.MessageHandler.GetConversations())
+		r.With(middlewares.RateLimit("send_message")).Post("/conversations", handlers.MessageHandler.SendDirectMessage())
+		r.Get("/conversations/{conversation_id}", handlers.MessageHandler.GetConversation())
+		r.Get("/conversations/{conversation_id}/messages", handlers.MessageHandler.GetMessages())
+		r.With(middlewares.RateLimit("send_message")).Post("/conversations/{conversation_id}/messages", handlers.MessageHandler.SendMessage())
+		r.Delete("/conversations/{conversation_id}/messages/{message_id}", handlers.MessageHandler.DeleteMessage())
+		r.Post("/conversations/{conversation_id}/read", handlers.MessageHandler.MarkConversationRead())
+
+		// Group conversations
+		r.Post("/conversations/groups", handlers.MessageHandler.CreateGroup())
+		r.Patch("/conversations/{conversation_id}", handlers.MessageHandler.RenameConversation())
+		r.Post("/conversations/{conversation_id}/participants", handlers.MessageHandler.AddParticipants())
+		r.Patch("/conversations/{conversation_id}/participants/{username}", handlers.MessageHandler.SetParticipantRole())
+		r.Delete("/conversations/{conversation_id}/participants/{username}", handlers.MessageHandler.RemoveParticipant())
+		r.Post("/conversations/{conversation_id}/leave", handlers.MessageHandler.LeaveConversation())
+
+		// Real-time events
+		r.Get("/stream", handlers.StreamHandler.Stream())
+	})
+
+	// Sessions or personal access tokens with the scope
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Auth(model.ScopeUsersRead))
+		r.Use(middlewares.RateLimit("default"))
+
 		r.Get("/{username}", handlers.UserHandler.GetUserByUsername())
-		r.Post("/{username}/follow", handlers.UserHandler.FollowUser())
-		r.Delete("/{username}/follow", handlers.UserHandler.StopFollowingUser())
 		r.Get("/{username}/followers", handlers.UserHandler.GetFollowersByUser())
 		r.Get("/{username}/following", handlers.UserHandler.GetFollowingByUser())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Auth(model.ScopeFollowsWrite))
+		r.Use(middlewares.RateLimit("default"))
+
+		r.With(middlewares.RateLimit("follow")).Put("/{username}/follow", handlers.UserHandler.FollowUser())
+		r.Delete("/{username}/follow", handlers.UserHandler.StopFollowingUser())
+		r.Put("/{username}/block", handlers.UserHandler.BlockUser())
+		r.Delete("/{username}/block", handlers.UserHandler.UnblockUser())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Auth(model.ScopePostsRead))
+		r.Use(middlewares.RateLimit("default"))
 
-		// Post
-		r.Post("/compose/post", handlers.PostHandler.CreatePost())
 		r.Get("/{username}/posts", handlers.PostHandler.GetUserPosts())
 		r.Get("/{username}/posts/{post_id}", handlers.PostHandler.GetUserPostByID())
+		r.Get("/{username}/reposts", handlers.PostHandler.GetUserReposts())
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.Auth(model.ScopePostsWrite))
+		r.Use(middlewares.RateLimit("default"))
+
+		r.With(middlewares.RateLimit("create_post")).Post("/compose/post", handlers.PostHandler.CreatePost())
 		r.Patch("/{username}/posts/{post_id}", handlers.PostHandler.UpdatePostContentByID())
 		r.Delete("/{username}/posts/{post_id}", handlers.PostHandler.DeletePostByID())
-		r.Get("/{username}/reposts", handlers.PostHandler.GetUserReposts())
-		r.Post("/{username}/posts/{post_id}/like", handlers.PostHandler.LikePost())
+		r.Put("/{username}/posts/{post_id}/like", handlers.PostHandler.LikePost())
 		r.Delete("/{username}/posts/{post_id}/like", handlers.PostHandler.UnlikePost())
-		r.Post("/{username}/posts/{post_id}/repost", handlers.PostHandler.RepostPost())
+		r.Put("/{username}/posts/{post_id}/repost", handlers.PostHandler.RepostPost())
 		r.Delete("/{username}/posts/{post_id}/repost", handlers.PostHandler.UndoRepostPost())
-		r.Post("/{username}/posts/{post_id}/quote", handlers.PostHandler.QuotePost())
+		r.With(middlewares.RateLimit("create_post")).Post("/{username}/posts/{post_id}/quote", handlers.PostHandler.QuotePost())
 	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte("Page not found"))
+		problem.Error(w, r, http.StatusNotFound, "page_not_found", "page not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
 	})
 
 	return r
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/utils/hash"
+)
+
+type AccountService struct {
+	accountRepo *repository.AccountRepository
+	userRepo    *repository.UserRepository
+	cfg         *config.Config
+}
+
+func NewAccountService(accountRepo *repository.AccountRepository, userRepo *repository.UserRepository, cfg *config.Config) *AccountService {
+	return &AccountService{accountRepo: accountRepo, userRepo: userRepo, cfg: cfg}
+}
+
+// Deactivate hides the account. Logging in within the reactivation window
+// restores it, afterwards it is deleted.
+func (s *AccountService) Deactivate(ctx context.Context, userID int, password string) error {
+	ctx, span := tracer.Start(ctx, "AccountService.Deactivate")
+	defer span.End()
+
+	if err := s.checkPassword(ctx, userID, password); err != nil {
+		return err
+	}
+	return s.accountRepo.DeactivateUser(ctx, userID)
+}
+
+// Delete hides the account at once and leaves its removal to the purge job.
+func (s *AccountService) Delete(ctx context.Context, userID int, password string) error {
+	ctx, span := tracer.Start(ctx, "AccountService.Delete")
+	defer span.End()
+
+	if err := s.checkPassword(ctx, userID, password); err != nil {
+		return err
+	}
+	return s.accountRepo.RequestUserDeletion(ctx, userID)
+}
+
+func (s *AccountService) checkPassword(ctx context.Context, userID int, password string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !hash.CheckPassword(password, user.Password) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// PurgeAccountsJob deletes the accounts pending deletion.
+type PurgeAccountsJob struct{}
+
+func (PurgeAccountsJob) JobType() string { return "accounts.purge" }
+
+func (s *AccountService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueMaintenance, s.purgeAccounts)
+}
+
+func (s *AccountService) purgeAccounts(ctx context.Context, _ PurgeAccountsJob) error {
+	ctx, span := tracer.Start(ctx, "AccountService.purgeAccounts")
+	defer span.End()
+
+	deactivatedBefore := time.Now().Add(-s.cfg.Account.ReactivationWindow)
+	userIDs, err := s.accountRepo.GetUsersPendingDeletion(ctx, deactivatedBefore, s.cfg.Account.DeletionBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		deleted, err := s.accountRepo.DeleteUser(ctx, userID, deactivatedBefore)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			logging.FromContext(ctx).WithField("user_id", userID).Info("account deleted")
+		}
+	}
+	return nil
+}
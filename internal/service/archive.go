@@ -0,0 +1,255 @@
+package service
+
+import (
+	"time"
+	"x-clone/internal/model"
+)
+
+// Archive layout shared by exports and imports: one JSON file per entry below
+// at the root of a zip file.
+const (
+	archiveFormat  = "x-clone-export"
+	archiveVersion = 1
+
+	archiveManifestFile  = "manifest.json"
+	archiveProfileFile   = "profile.json"
+	archivePostsFile     = "posts.json"
+	archiveLikesFile     = "likes.json"
+	archiveRepostsFile   = "reposts.json"
+	archiveFollowersFile = "followers.json"
+	archiveFollowingFile = "following.json"
+
+	// Export only, ignored on import
+	archiveBlocksFile       = "blocks.json"
+	archiveMessagesFile     = "messages.json"
+	archiveSessionsFile     = "sessions.json"
+	archiveLoginEventsFile  = "login_events.json"
+	archiveAccessTokensFile = "access_tokens.json"
+	archiveWebhooksFile     = "webhooks.json"
+)
+
+// archiveExclusions lists the user's data left out of exports on purpose.
+var archiveExclusions = []string{
+	"password hash, two-factor secret and recovery codes",
+	"values of access tokens and webhook secrets",
+	"webhook deliveries",
+	"messages deleted for yourself",
+	"past exports and imports",
+}
+
+type archiveManifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Username   string    `json:"username"`
+	Excluded   []string  `json:"excluded"`
+}
+
+type archiveProfile struct {
+	Username        string     `json:"username"`
+	Email           *string    `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Birthday        *string    `json:"birthday"`
+	Bio             *string    `json:"bio"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// archivePost is one of the user's posts, or a post they liked or reposted
+// with Username set to its author.
+type archivePost struct {
+	PostID         int       `json:"post_id"`
+	Username       string    `json:"username,omitempty"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	OriginalPostID *int      `json:"original_post_id"`
+	Likes          int       `json:"likes"`
+	Reposts        int       `json:"reposts"`
+}
+
+type archiveUser struct {
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// archiveConversation is a conversation of the user with the messages they did
+// not delete.
+type archiveConversation struct {
+	ConversationID int              `json:"conversation_id"`
+	Kind           string           `json:"kind"`
+	Name           *string          `json:"name"`
+	Participants   []string         `json:"participants"` // Usernames
+	CreatedAt      time.Time        `json:"created_at"`
+	Messages       []archiveMessage `json:"messages"`
+}
+
+type archiveMessage struct {
+	MessageID int       `json:"message_id"`
+	Kind      string    `json:"kind"`
+	Sender    string    `json:"sender"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type archiveSession struct {
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type archiveLoginEvent struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// archiveAccessToken is the metadata of a personal access token, without its value.
+type archiveAccessToken struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// archiveWebhook is a webhook without its secret.
+type archiveWebhook struct {
+	URL        string     `json:"url"`
+	Events     []string   `json:"events"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func toArchiveProfile(user *model.User) archiveProfile {
+	return archiveProfile{
+		Username:        user.Username,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Birthday:        user.Birthday,
+		Bio:             user.Bio,
+		CreatedAt:       user.CreatedAt,
+	}
+}
+
+func toArchivePost(post model.Post, username string) archivePost {
+	return archivePost{
+		PostID:         post.PostID,
+		Username:       username,
+		Content:        post.Content,
+		CreatedAt:      post.CreatedAt,
+		OriginalPostID: post.OriginalPostID,
+		Likes:          post.Likes,
+		Reposts:        post.Reposts,
+	}
+}
+
+func toArchiveUsers(users []model.User) []archiveUser {
+	archived := make([]archiveUser, 0, len(users))
+	for _, user := range users {
+		archived = append(archived, archiveUser{Username: user.Username, FirstName: user.FirstName, LastName: user.LastName})
+	}
+	return archived
+}
+
+func toArchiveConversations(conversations []model.Conversation, messages []model.Message) []archiveConversation {
+	byConversation := make(map[int][]archiveMessage, len(conversations))
+	for _, message := range messages {
+		byConversation[message.ConversationID] = append(byConversation[message.ConversationID], archiveMessage{
+			MessageID: message.MessageID,
+			Kind:      message.Kind,
+			Sender:    message.Sender,
+			Content:   message.Content,
+			CreatedAt: message.CreatedAt,
+		})
+	}
+
+	archived := make([]archiveConversation, 0, len(conversations))
+	for _, conversation := range conversations {
+		participants := make([]string, 0, len(conversation.Participants))
+		for _, participant := range conversation.Participants {
+			participants = append(participants, participant.User.Username)
+		}
+		conversationMessages := byConversation[conversation.ConversationID]
+		if conversationMessages == nil {
+			conversationMessages = []archiveMessage{}
+		}
+		archived = append(archived, archiveConversation{
+			ConversationID: conversation.ConversationID,
+			Kind:           conversation.Kind,
+			Name:           conversation.Name,
+			Participants:   participants,
+			CreatedAt:      conversation.CreatedAt,
+			Messages:       conversationMessages,
+		})
+	}
+	return archived
+}
+
+func toArchiveSessions(sessions []model.Session) []archiveSession {
+	archived := make([]archiveSession, 0, len(sessions))
+	for _, session := range sessions {
+		archived = append(archived, archiveSession{
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			RevokedAt:  session.RevokedAt,
+		})
+	}
+	return archived
+}
+
+func toArchiveLoginEvents(events []model.LoginEvent) []archiveLoginEvent {
+	archived := make([]archiveLoginEvent, 0, len(events))
+	for _, event := range events {
+		archived = append(archived, archiveLoginEvent{
+			IP:        event.IP,
+			UserAgent: event.UserAgent,
+			Success:   event.Success,
+			Reason:    event.Reason,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return archived
+}
+
+func toArchiveAccessTokens(tokens []model.PersonalAccessToken) []archiveAccessToken {
+	archived := make([]archiveAccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		archived = append(archived, archiveAccessToken{
+			Name:       token.Name,
+			Prefix:     token.Prefix,
+			Scopes:     token.Scopes,
+			CreatedAt:  token.CreatedAt,
+			LastUsedAt: token.LastUsedAt,
+			ExpiresAt:  token.ExpiresAt,
+			RevokedAt:  token.RevokedAt,
+		})
+	}
+	return archived
+}
+
+func toArchiveWebhooks(webhooks []model.Webhook) []archiveWebhook {
+	archived := make([]archiveWebhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		archived = append(archived, archiveWebhook{
+			URL:        webhook.URL,
+			Events:     webhook.Events,
+			CreatedAt:  webhook.CreatedAt,
+			DisabledAt: webhook.DisabledAt,
+		})
+	}
+	return archived
+}
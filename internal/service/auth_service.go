@@ -1,27 +1,42 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 	"x-clone/internal/config"
 	"x-clone/internal/model"
 	"x-clone/internal/repository"
+	"x-clone/pkg/jwtkeys"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/mailer"
+	"x-clone/pkg/metrics"
 	"x-clone/pkg/utils/hash"
 
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type AuthService struct {
-	authRepo *repository.AuthRepository
-	userRepo *repository.UserRepository
-	cfg      *config.Config
+	authRepo    *repository.AuthRepository
+	accountRepo *repository.AccountRepository
+	userRepo    *repository.UserRepository
+	mfaRepo     *repository.MFARepository
+	sessionRepo *repository.SessionRepository
+	tokenRepo   *repository.TokenRepository
+	keys        *jwtkeys.Manager
+	mailer      mailer.Mailer
+	cfg         *config.Config
 }
 
-func NewAuthService(authRepo *repository.AuthRepository, userRepo *repository.UserRepository, cfg *config.Config) *AuthService {
-	return &AuthService{authRepo: authRepo, userRepo: userRepo, cfg: cfg}
+func NewAuthService(authRepo *repository.AuthRepository, accountRepo *repository.AccountRepository, userRepo *repository.UserRepository, mfaRepo *repository.MFARepository, sessionRepo *repository.SessionRepository, tokenRepo *repository.TokenRepository, keys *jwtkeys.Manager, mailer mailer.Mailer, cfg *config.Config) *AuthService {
+	return &AuthService{authRepo: authRepo, accountRepo: accountRepo, userRepo: userRepo, mfaRepo: mfaRepo, sessionRepo: sessionRepo, tokenRepo: tokenRepo, keys: keys, mailer: mailer, cfg: cfg}
 }
 
-func (s *AuthService) Register(user *model.User) (string, error) {
+func (s *AuthService) Register(ctx context.Context, user *model.User, client ClientInfo) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	defer span.End()
+
 	// Hash password
 	hashedPassword, err := hash.HashPassword(user.Password)
 	if err != nil {
@@ -30,57 +45,191 @@ func (s *AuthService) Register(user *model.User) (string, error) {
 	user.Password = hashedPassword
 
 	// Repo call
-	if err := s.authRepo.CreateUser(user); err != nil {
-		return "", errors.New("user already exists")
+	email := normalizeEmail(*user.Email)
+	user.Email = &email
+	if err := s.authRepo.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return "", ErrUserAlreadyExists
+		}
+		return "", err
 	}
 
+	// Verify email
+	s.sendEmailVerificationAsync(ctx, user, email)
+
 	// Return access token
-	return s.GenerateAccessToken(user)
+	return s.startSession(ctx, user, client)
 }
 
-func (s *AuthService) Login(username, password string) (string, error) {
+type LoginResult struct {
+	AccessToken string
+	MFAToken    string // Set instead of AccessToken when a second factor is required
+}
+
+func (s *AuthService) Login(ctx context.Context, username, password string, client ClientInfo) (*LoginResult, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	userKey, ipKey := "user:"+username, "ip:"+client.IP
+
+	// Check lockout
+	retryAfter, err := s.loginLockout(ctx, userKey, ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		metrics.LoginsTotal.WithLabelValues(metrics.LoginLocked).Inc()
+		if user, err := s.userRepo.FindUserByUsername(ctx, username); err == nil {
+			s.recordLoginEvent(ctx, user.UserID, client, false, "locked")
+		}
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
 	// Check user db
-	user, err := s.userRepo.FindUserByUsername(username)
+	user, err := s.userRepo.FindUserByUsername(ctx, username)
 	if err != nil {
-		return "", errors.New("invalid username")
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		hash.CheckDummyPassword(password) // Same timing as a wrong password
+		if err := s.loginFailed(ctx, nil, userKey, ipKey, client, "unknown_username"); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
 	// Check password
 	if !hash.CheckPassword(password, user.Password) {
-		return "", errors.New("invalid password")
+		if err := s.loginFailed(ctx, user, userKey, ipKey, client, "invalid_password"); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if !s.canReactivate(user) {
+		if err := s.loginFailed(ctx, user, userKey, ipKey, client, "account_deleted"); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
+	s.upgradePasswordHash(ctx, user, password)
+
+	// Second factor
+	enabled, err := s.mfaEnabled(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		mfaToken, err := s.generateMFAToken(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	return s.loginSucceeded(ctx, user, userKey, client)
+}
+
+func (s *AuthService) loginSucceeded(ctx context.Context, user *model.User, userKey string, client ClientInfo) (*LoginResult, error) {
+	// Reactivate
+	if user.DeactivatedAt != nil {
+		if err := s.accountRepo.ReactivateUser(ctx, user.UserID); err != nil {
+			return nil, err
+		}
+		logging.FromContext(ctx).WithField("user_id", user.UserID).Info("account reactivated")
+	}
+
+	// Reset failures
+	if err := s.authRepo.ResetLoginFailures(ctx, userKey); err != nil {
+		return nil, err
+	}
+	s.recordLoginEvent(ctx, user.UserID, client, true, "")
+	metrics.LoginsTotal.WithLabelValues(metrics.LoginSucceeded).Inc()
 
 	// Return access token
-	return s.GenerateAccessToken(user)
+	accessToken, err := s.startSession(ctx, user, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{AccessToken: accessToken}, nil
+}
+
+// canReactivate reports whether the account can still sign in: it is active or
+// was deactivated within the reactivation window and not scheduled for deletion.
+func (s *AuthService) canReactivate(user *model.User) bool {
+	if user.DeletionRequestedAt != nil {
+		return false
+	}
+	return user.DeactivatedAt == nil || time.Since(*user.DeactivatedAt) < s.cfg.Account.ReactivationWindow
+}
+
+// upgradePasswordHash rehashes a verified password with the configured
+// algorithm and parameters. Best effort, the login goes on either way.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user *model.User, password string) {
+	if !hash.NeedsRehash(user.Password) {
+		return
+	}
+	hashedPassword, err := hash.HashPassword(password)
+	if err == nil {
+		err = s.userRepo.PasswordChange(ctx, user.UserID, hashedPassword)
+	}
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("failed to upgrade password hash")
+		return
+	}
+	user.Password = hashedPassword
+}
+
+func (s *AuthService) GetLoginEvents(ctx context.Context, userID int) ([]model.LoginEvent, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetLoginEvents")
+	defer span.End()
+
+	return s.authRepo.GetLoginEvents(ctx, userID, s.cfg.LoginProtection.EventsLimit)
 }
 
 // JWT
 
-func (s *AuthService) GenerateAccessToken(user *model.User) (string, error) {
+func (s *AuthService) GenerateAccessToken(user *model.User, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":    user.UserID,
+		"sid":        sessionID,
 		"username":   user.Username,
 		"first_name": user.FirstName,
 		"last_name":  user.LastName,
+		"iat":        time.Now().Unix(),
 		"exp":        time.Now().Add(s.cfg.JWT.AccessTokenTTL).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.cfg.JWT.Secret))
+	return s.keys.Sign(claims)
 }
 
-func (s *AuthService) ValidateAccessToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.cfg.JWT.Secret), nil
-	})
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid token")
+func (s *AuthService) ValidateAccessToken(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.keys.Parse(ctx, tokenString)
+	if err != nil || claims["typ"] == mfaTokenType {
+		return nil, ErrInvalidToken
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sessionID, ok := claims["sid"].(string)
 	if !ok {
-		return nil, errors.New("invalid token claims")
+		return nil, ErrInvalidToken
 	}
 
+	// Check session
+	session, err := s.sessionRepo.GetActiveSession(ctx, sessionID, int(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	s.touchSession(ctx, session)
+
 	return claims, nil
 }
+
+// JWKS lists the public keys verifiers need for access tokens.
+func (s *AuthService) JWKS() jwtkeys.JWKSet {
+	return s.keys.JWKS()
+}
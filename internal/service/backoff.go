@@ -0,0 +1,14 @@
+package service
+
+import "time"
+
+// backoff is the delay before retrying after the given number of failed
+// attempts: base, doubled after every further failure, up to max. Login
+// lockouts, outbox events, webhook deliveries and jobs all back off with it.
+func backoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CounterReport sums up a reconciliation of the denormalized counters.
+type CounterReport struct {
+	Posts   int // Checked
+	Users   int
+	Drifted int  // Counters that differed from their rows
+	Fixed   bool // false on a dry run
+}
+
+// CounterService recomputes the like, repost and follow counters from the
+// rows they count.
+type CounterService struct {
+	counterRepo *repository.CounterRepository
+	cfg         *config.Config
+}
+
+func NewCounterService(counterRepo *repository.CounterRepository, cfg *config.Config) *CounterService {
+	return &CounterService{counterRepo: counterRepo, cfg: cfg}
+}
+
+// ReconcileCountersJob reconciles the counters, only reporting the drifts on a dry run.
+type ReconcileCountersJob struct {
+	DryRun bool `json:"dry_run"`
+}
+
+func (ReconcileCountersJob) JobType() string { return "counters.reconcile" }
+
+func (s *CounterService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueMaintenance, s.reconcileJob)
+}
+
+func (s *CounterService) reconcileJob(ctx context.Context, job ReconcileCountersJob) error {
+	_, err := s.Reconcile(ctx, !job.DryRun)
+	return err
+}
+
+// Reconcile checks the counters of every post and user in batches, logging
+// each drift and, with fix, setting the counter to the actual count. A batch
+// is locked only while it is fixed.
+func (s *CounterService) Reconcile(ctx context.Context, fix bool) (*CounterReport, error) {
+	ctx, span := tracer.Start(ctx, "CounterService.Reconcile")
+	defer span.End()
+
+	report := &CounterReport{Fixed: fix}
+	var err error
+	if report.Posts, err = s.reconcile(ctx, s.counterRepo.ReconcilePostCounters, fix, report); err != nil {
+		return nil, err
+	}
+	if report.Users, err = s.reconcile(ctx, s.counterRepo.ReconcileUserCounters, fix, report); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{
+		"posts":   report.Posts,
+		"users":   report.Users,
+		"drifted": report.Drifted,
+		"fixed":   report.Fixed,
+	}).Info("counters reconciled")
+	return report, nil
+}
+
+type reconcileBatch func(ctx context.Context, afterID, limit int, fix bool) (int, int, []model.CounterDrift, error)
+
+// reconcile runs the batches of a table and returns the rows checked.
+func (s *CounterService) reconcile(ctx context.Context, batch reconcileBatch, fix bool, report *CounterReport) (int, error) {
+	checked, afterID := 0, 0
+	for {
+		lastID, n, drifts, err := batch(ctx, afterID, s.cfg.Counters.BatchSize, fix)
+		if err != nil {
+			return 0, err
+		}
+		checked += n
+
+		for _, drift := range drifts {
+			metrics.CounterDriftsTotal.WithLabelValues(drift.Table + "." + drift.Counter).Inc()
+			logging.FromContext(ctx).WithFields(logrus.Fields{
+				"table":   drift.Table,
+				"id":      drift.ID,
+				"counter": drift.Counter,
+				"stored":  drift.Stored,
+				"actual":  drift.Actual,
+			}).Warn("counter drifted")
+		}
+		report.Drifted += len(drifts)
+
+		if n < s.cfg.Counters.BatchSize {
+			return checked, nil
+		}
+		afterID = lastID
+
+		// Leave room to the writers between batches
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(s.cfg.Counters.BatchPause):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/mailer"
+
+	"gorm.io/gorm"
+)
+
+// VerifyEmail confirms an address with an emailed token. For an email change
+// the new address replaces the old one only now.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.VerifyEmail")
+	defer span.End()
+
+	userID, err := s.authRepo.VerifyEmail(ctx, hashSecretToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).WithField("user_id", userID).Info("email verified")
+	return nil
+}
+
+// ResendEmailVerification sends a new link for the current unverified address
+// and invalidates earlier ones.
+func (s *AuthService) ResendEmailVerification(ctx context.Context, userID int) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResendEmailVerification")
+	defer span.End()
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	if user.Email == nil {
+		return newError(ErrInvalid, "email_missing", "set an email address first")
+	}
+
+	return s.sendEmailVerification(ctx, user, *user.Email)
+}
+
+// ChangeEmail sends a verification link to a new address. The current address
+// stays in place until the link is used.
+func (s *AuthService) ChangeEmail(ctx context.Context, userID int, email string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ChangeEmail")
+	defer span.End()
+
+	email = normalizeEmail(email)
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Email != nil && *user.Email == email && user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	existing, err := s.userRepo.FindUserByEmail(ctx, email)
+	if err == nil && existing.UserID != userID {
+		return ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return s.sendEmailVerification(ctx, user, email)
+}
+
+// sendEmailVerificationAsync keeps registration independent of the mail server.
+func (s *AuthService) sendEmailVerificationAsync(ctx context.Context, user *model.User, email string) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+		defer cancel()
+
+		if err := s.sendEmailVerification(ctx, user, email); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to send verification email")
+		}
+	}()
+}
+
+func (s *AuthService) sendEmailVerification(ctx context.Context, user *model.User, email string) error {
+	token, tokenHash, err := generateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := s.authRepo.CreateEmailVerificationToken(ctx, &model.EmailVerificationToken{
+		UserID:    user.UserID,
+		Email:     email,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(s.cfg.EmailVerification.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your X-clone email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm this email address with the link below. It expires in %s.\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.FirstName,
+			s.cfg.EmailVerification.TokenTTL,
+			fmt.Sprintf(s.cfg.EmailVerification.URL, token)),
+	})
+}
+
+// requireVerifiedEmail guards actions unverified accounts may not take.
+func requireVerifiedEmail(ctx context.Context, userRepo *repository.UserRepository, userID int) error {
+	user, err := userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
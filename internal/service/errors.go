@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"time"
+)
+
+// Error kinds. Handlers map them to HTTP status codes with errors.Is.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrForbidden     = errors.New("forbidden")
+	ErrInvalid       = errors.New("invalid")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrTooMany       = errors.New("too many requests")
+	ErrTooLarge      = errors.New("too large")
+)
+
+var (
+	ErrUserNotFound             = newError(ErrNotFound, "user_not_found", "user not found")
+	ErrUserAlreadyExists        = newError(ErrAlreadyExists, "user_already_exists", "user already exists")
+	ErrUsernameTaken            = newError(ErrAlreadyExists, "username_taken", "username is already taken")
+	ErrPostNotFound             = newError(ErrNotFound, "post_not_found", "post not found")
+	ErrNotPostOwner             = newError(ErrForbidden, "not_post_owner", "you are not owner of this post")
+	ErrSelfFollow               = newError(ErrForbidden, "self_follow", "you cannot follow yourself")
+	ErrSelfUnfollow             = newError(ErrForbidden, "self_unfollow", "you cannot stop following yourself")
+	ErrInvalidCredentials       = newError(ErrUnauthorized, "invalid_credentials", "invalid username or password")
+	ErrInvalidOldPassword       = newError(ErrInvalid, "invalid_old_password", "invalid old_password")
+	ErrInvalidPassword          = newError(ErrInvalid, "invalid_password", "invalid password")
+	ErrInvalidToken             = newError(ErrUnauthorized, "invalid_token", "invalid token")
+	ErrMFANotEnrolled           = newError(ErrInvalid, "mfa_not_enrolled", "two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled        = newError(ErrAlreadyExists, "mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrInvalidMFACode           = newError(ErrInvalid, "invalid_mfa_code", "invalid two-factor code")
+	ErrMFAFailed                = newError(ErrUnauthorized, "mfa_failed", "invalid two-factor code")
+	ErrInvalidMFAToken          = newError(ErrUnauthorized, "invalid_mfa_token", "invalid or expired mfa_token")
+	ErrInvalidResetToken        = newError(ErrInvalid, "invalid_reset_token", "invalid or expired reset token")
+	ErrSessionNotFound          = newError(ErrNotFound, "session_not_found", "session not found")
+	ErrTokenNotFound            = newError(ErrNotFound, "token_not_found", "token not found")
+	ErrEmailTaken               = newError(ErrAlreadyExists, "email_taken", "email is already taken")
+	ErrEmailNotVerified         = newError(ErrForbidden, "email_not_verified", "verify your email address first")
+	ErrEmailAlreadyVerified     = newError(ErrInvalid, "email_already_verified", "email address is already verified")
+	ErrInvalidVerificationToken = newError(ErrInvalid, "invalid_verification_token", "invalid or expired verification token")
+	ErrExportNotFound           = newError(ErrNotFound, "export_not_found", "export not found")
+	ErrExportNotReady           = newError(ErrInvalid, "export_not_ready", "export is not ready yet")
+	ErrExportExpired            = newError(ErrNotFound, "export_expired", "export has expired")
+	ErrExportLimit              = newError(ErrTooMany, "export_limit", "only one export per day is allowed")
+	ErrImportNotFound           = newError(ErrNotFound, "import_not_found", "import not found")
+	ErrImportInProgress         = newError(ErrAlreadyExists, "import_in_progress", "another import is still in progress")
+	ErrImportTooLarge           = newError(ErrTooLarge, "import_too_large", "uploaded archive is too large")
+	ErrInvalidCursor            = newError(ErrInvalid, "invalid_cursor", "invalid cursor")
+	ErrSelfBlock                = newError(ErrForbidden, "self_block", "you cannot block yourself")
+	ErrUserBlocked              = newError(ErrForbidden, "user_blocked", "you cannot interact with this user")
+	ErrSelfMessage              = newError(ErrForbidden, "self_message", "you cannot message yourself")
+	ErrCannotMessage            = newError(ErrForbidden, "cannot_message", "this user does not accept messages from you")
+	ErrConversationNotFound     = newError(ErrNotFound, "conversation_not_found", "conversation not found")
+	ErrMessageNotFound          = newError(ErrNotFound, "message_not_found", "message not found")
+	ErrNotGroupConversation     = newError(ErrInvalid, "not_group_conversation", "only group conversations support this")
+	ErrNotConversationAdmin     = newError(ErrForbidden, "not_conversation_admin", "only group admins can do this")
+	ErrParticipantNotFound      = newError(ErrNotFound, "participant_not_found", "participant not found")
+	ErrGroupTooLarge            = newError(ErrInvalid, "group_too_large", "the group would have too many participants")
+	ErrLastAdmin                = newError(ErrInvalid, "last_admin", "a group needs at least one admin")
+	ErrTooManyConnections       = newError(ErrTooMany, "too_many_connections", "too many open gateway connections")
+	ErrTooManySubscriptions     = newError(ErrTooMany, "too_many_subscriptions", "too many channel subscriptions")
+	ErrInvalidChannel           = newError(ErrInvalid, "invalid_channel", "invalid channel")
+	ErrNotSubscribed            = newError(ErrInvalid, "not_subscribed", "not subscribed to the channel")
+	ErrWebhookNotFound          = newError(ErrNotFound, "webhook_not_found", "webhook not found")
+	ErrTooManyWebhooks          = newError(ErrTooMany, "too_many_webhooks", "too many webhooks")
+	ErrTooManyStreams           = newError(ErrTooMany, "too_many_streams", "too many open event streams")
+	ErrEmptyImport              = newError(ErrInvalid, "empty_import", "uploaded archive is empty")
+)
+
+// DomainError is an error with a stable code, a client-facing message and one of the kinds above.
+type DomainError struct {
+	kind    error
+	code    string
+	message string
+}
+
+func newError(kind error, code, message string) *DomainError {
+	return &DomainError{kind: kind, code: code, message: message}
+}
+
+func (e *DomainError) Code() string {
+	return e.code
+}
+
+func (e *DomainError) Error() string {
+	return e.message
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.kind
+}
+
+// LoginLockedError is returned while an account or client IP is locked out.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+func (e *LoginLockedError) Code() string {
+	return "login_locked"
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooMany
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/eventbus"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/pubsub"
+)
+
+// Event types delivered on the event stream and the gateway
+const (
+	EventPostCreated    = "post.created"    // To followers of the author, home channel
+	EventPostLiked      = "post.liked"      // To the author, post channel
+	EventPostReposted   = "post.reposted"   // To the author, post channel
+	EventPostQuoted     = "post.quoted"     // To the author of the quoted post, post channel
+	EventUserFollowed   = "user.followed"   // To the followed user
+	EventMessageCreated = "message.created" // Conversation channel
+	EventTyping         = "typing"          // Conversation channel
+)
+
+// Gateway channels clients subscribe to
+const (
+	ChannelHome         = "home"
+	channelPost         = "post:%d"
+	channelConversation = "conversation:%d"
+)
+
+type postEvent struct {
+	Username string      `json:"username"` // Author
+	Post     *model.Post `json:"post"`
+}
+
+type interactionEvent struct {
+	Username string `json:"username"` // Who liked or reposted
+	PostID   int    `json:"post_id"`
+}
+
+type followEvent struct {
+	Username string `json:"username"` // New follower
+}
+
+type typingEvent struct {
+	Username string `json:"username"`
+}
+
+// publisher sends events on the bus to users and on the hub to channel
+// subscribers. Publishing is best effort: a failure is logged and never fails
+// the action that caused the event. Services that publish to one of the two
+// only set that one.
+type publisher struct {
+	bus      *eventbus.Bus
+	hub      *pubsub.Hub
+	userRepo *repository.UserRepository
+}
+
+// homeTopic is the hub topic of a user's home channel.
+func homeTopic(userID int) string {
+	return fmt.Sprintf("home:%d", userID)
+}
+
+func postTopic(postID int) string {
+	return fmt.Sprintf(channelPost, postID)
+}
+
+func conversationTopic(conversationID int) string {
+	return fmt.Sprintf(channelConversation, conversationID)
+}
+
+// idle reports whether nobody is connected to receive events.
+func (p publisher) idle() bool {
+	return (p.bus == nil || p.bus.Idle()) && (p.hub == nil || p.hub.Idle())
+}
+
+// activeRecipients keeps the users that would receive events.
+func (p publisher) activeRecipients(userIDs ...int) []int {
+	if p.bus == nil {
+		return nil
+	}
+	var active []int
+	for _, userID := range userIDs {
+		if p.bus.Active(userID) {
+			active = append(active, userID)
+		}
+	}
+	return active
+}
+
+// activeTopics keeps the topics someone is subscribed to.
+func (p publisher) activeTopics(topics ...string) []string {
+	if p.hub == nil {
+		return nil
+	}
+	var active []string
+	for _, topic := range topics {
+		if p.hub.Active(topic) {
+			active = append(active, topic)
+		}
+	}
+	return active
+}
+
+// publishFromUser publishes an event about userID's action to the recipients
+// on the bus and to the topics of the channel on the hub. data is built with
+// their username only if someone receives it.
+func (p publisher) publishFromUser(ctx context.Context, userID int, eventType string, data func(username string) interface{}, recipients []int, channel string, topics ...string) {
+	recipients = p.activeRecipients(recipients...)
+	topics = p.activeTopics(topics...)
+	if len(recipients) == 0 && len(topics) == 0 {
+		return
+	}
+	user, err := p.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event", eventType).Warn("failed to publish event")
+		return
+	}
+
+	payload := data(user.Username)
+	if len(recipients) > 0 {
+		if err := p.bus.Publish(eventType, payload, recipients...); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("event", eventType).Warn("failed to publish event")
+		}
+	}
+	if len(topics) > 0 {
+		event := pubsub.Event{Type: eventType, Channel: channel, Data: payload}
+		if err := p.hub.Publish(event, nil, topics...); err != nil {
+			logging.FromContext(ctx).WithError(err).WithField("event", eventType).Warn("failed to publish event")
+		}
+	}
+}
+
+// postCreated goes to the followers of the author, and to the author's own
+// home channel.
+func (p publisher) postCreated(ctx context.Context, post *model.Post) {
+	if p.idle() {
+		return
+	}
+	followerIDs, err := p.userRepo.GetFollowerIDs(ctx, post.UserID)
+	if err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event", EventPostCreated).Warn("failed to publish event")
+		return
+	}
+	topics := []string{homeTopic(post.UserID)}
+	for _, followerID := range followerIDs {
+		topics = append(topics, homeTopic(followerID))
+	}
+	p.publishFromUser(ctx, post.UserID, EventPostCreated, func(username string) interface{} {
+		return postEvent{Username: username, Post: post}
+	}, followerIDs, ChannelHome, topics...)
+}
+
+// postInteraction notifies the author of a post someone else interacted with,
+// and the post's channel.
+func (p publisher) postInteraction(ctx context.Context, userID int, post *model.Post, eventType string) {
+	var recipients []int
+	if post.UserID != userID {
+		recipients = append(recipients, post.UserID)
+	}
+	topic := postTopic(post.PostID)
+	p.publishFromUser(ctx, userID, eventType, func(username string) interface{} {
+		return interactionEvent{Username: username, PostID: post.PostID}
+	}, recipients, topic, topic)
+}
+
+func (p publisher) postQuoted(ctx context.Context, quote *model.Post) {
+	if quote.OriginalPost == nil {
+		return
+	}
+	var recipients []int
+	if quote.OriginalPost.UserID != quote.UserID {
+		recipients = append(recipients, quote.OriginalPost.UserID)
+	}
+	topic := postTopic(quote.OriginalPost.PostID)
+	p.publishFromUser(ctx, quote.UserID, EventPostQuoted, func(username string) interface{} {
+		return postEvent{Username: username, Post: quote}
+	}, recipients, topic, topic)
+}
+
+func (p publisher) userFollowed(ctx context.Context, followerID, followingID int) {
+	p.publishFromUser(ctx, followerID, EventUserFollowed, func(username string) interface{} {
+		return followEvent{Username: username}
+	}, []int{followingID}, "")
+}
+
+// messageCreated goes to the conversation channel. The message carries its
+// sender's username already.
+func (p publisher) messageCreated(ctx context.Context, message *model.Message) {
+	topic := conversationTopic(message.ConversationID)
+	if p.hub == nil || !p.hub.Active(topic) {
+		return
+	}
+	event := pubsub.Event{Type: EventMessageCreated, Channel: topic, Data: message}
+	if err := p.hub.Publish(event, nil, topic); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event", EventMessageCreated).Warn("failed to publish event")
+	}
+}
+
+// participantRemoved unsubscribes a user who left or was removed from the
+// conversation channel.
+func (p publisher) participantRemoved(ctx context.Context, conversationID, userID int) {
+	if p.hub == nil {
+		return
+	}
+	topic := conversationTopic(conversationID)
+	event := pubsub.Event{Type: EventUnsubscribed, Channel: topic}
+	if err := p.hub.Kick(topic, userID, event); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event", EventUnsubscribed).Warn("failed to publish event")
+	}
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type ExportService struct {
+	exportRepo *repository.ExportRepository
+	userRepo   *repository.UserRepository
+	postRepo   *repository.PostRepository
+	jobs       *JobService
+	cfg        *config.Config
+}
+
+func NewExportService(exportRepo *repository.ExportRepository, userRepo *repository.UserRepository, postRepo *repository.PostRepository, jobs *JobService, cfg *config.Config) *ExportService {
+	return &ExportService{exportRepo: exportRepo, userRepo: userRepo, postRepo: postRepo, jobs: jobs, cfg: cfg}
+}
+
+// RequestExport queues an archive of the user's data, at most one per limit_period.
+func (s *ExportService) RequestExport(ctx context.Context, userID int) (*model.DataExport, error) {
+	ctx, span := tracer.Start(ctx, "ExportService.RequestExport")
+	defer span.End()
+
+	export := &model.DataExport{UserID: userID, Status: model.ExportPending}
+	created, err := s.exportRepo.CreateExport(ctx, export, time.Now().Add(-s.cfg.Export.LimitPeriod))
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrExportLimit
+	}
+	if _, err := s.jobs.Enqueue(ctx, BuildExportJob{ExportID: export.DataExportID}); err != nil {
+		// Failed exports do not count against the limit
+		if err := s.exportRepo.FailExport(ctx, export.DataExportID, "failed to queue the export"); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to save export")
+		}
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *ExportService) GetExport(ctx context.Context, userID, exportID int) (*model.DataExport, error) {
+	ctx, span := tracer.Start(ctx, "ExportService.GetExport")
+	defer span.End()
+
+	export, err := s.exportRepo.GetExport(ctx, userID, exportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	return export, nil
+}
+
+// OpenExport returns the archive of a completed export that has not expired.
+func (s *ExportService) OpenExport(ctx context.Context, userID, exportID int) (*os.File, *model.DataExport, error) {
+	ctx, span := tracer.Start(ctx, "ExportService.OpenExport")
+	defer span.End()
+
+	export, err := s.GetExport(ctx, userID, exportID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case export.Status == model.ExportExpired,
+		export.Status == model.ExportCompleted && time.Now().After(*export.ExpiresAt):
+		return nil, nil, ErrExportExpired
+	case export.Status != model.ExportCompleted:
+		return nil, nil, ErrExportNotReady
+	}
+
+	file, err := os.Open(s.archivePath(export.DataExportID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, export, nil
+}
+
+// BuildExportJob builds the archive of a requested export.
+type BuildExportJob struct {
+	ExportID int `json:"export_id"`
+}
+
+func (BuildExportJob) JobType() string { return "exports.build" }
+
+// CleanupExportsJob expires exports past their link TTL and removes the
+// archives no longer downloadable.
+type CleanupExportsJob struct{}
+
+func (CleanupExportsJob) JobType() string { return "exports.cleanup" }
+
+func (s *ExportService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueArchives, s.buildExport)
+	RegisterJob(jobs, QueueMaintenance, s.cleanup)
+}
+
+// buildExport runs the export again if a crashed worker left it running. An
+// archive that cannot be built fails the export without further attempts.
+func (s *ExportService) buildExport(ctx context.Context, job BuildExportJob) error {
+	export, err := s.exportRepo.StartExport(ctx, job.ExportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Finished, or deleted with its user
+		}
+		return err
+	}
+
+	size, err := s.buildArchive(ctx, export)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		if err := s.exportRepo.FailExport(ctx, export.DataExportID, "failed to build the archive"); err != nil {
+			return err
+		}
+		return PermanentJobError(err)
+	}
+	if err := s.exportRepo.CompleteExport(ctx, export.DataExportID, size, time.Now().Add(s.cfg.Export.LinkTTL)); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).WithFields(logrus.Fields{"export_id": export.DataExportID, "user_id": export.UserID}).Info("export completed")
+	return nil
+}
+
+func (s *ExportService) cleanup(ctx context.Context, _ CleanupExportsJob) error {
+	if err := s.exportRepo.ExpireExports(ctx); err != nil {
+		return err
+	}
+	return s.sweepArchives(ctx)
+}
+
+func (s *ExportService) buildArchive(ctx context.Context, export *model.DataExport) (int64, error) {
+	ctx, span := tracer.Start(ctx, "ExportService.buildArchive")
+	defer span.End()
+
+	files, err := s.collect(ctx, export.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file so a download never sees a partial archive
+	if err := os.MkdirAll(s.cfg.Export.Dir, 0o700); err != nil {
+		return 0, err
+	}
+	path := s.archivePath(export.DataExportID)
+	tmp, err := os.CreateTemp(s.cfg.Export.Dir, "export-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := zip.NewWriter(tmp)
+	for _, name := range []string{
+		archiveManifestFile, archiveProfileFile, archivePostsFile, archiveLikesFile,
+		archiveRepostsFile, archiveFollowersFile, archiveFollowingFile, archiveBlocksFile,
+		archiveMessagesFile, archiveSessionsFile, archiveLoginEventsFile, archiveAccessTokensFile,
+		archiveWebhooksFile,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			tmp.Close()
+			return 0, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(files[name]); err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return info.Size(), os.Rename(tmp.Name(), path)
+}
+
+// collect gathers the content of every archive file.
+func (s *ExportService) collect(ctx context.Context, userID int) (map[string]interface{}, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := s.postRepo.GetUserPosts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	liked, err := s.exportRepo.GetLikedPosts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	reposted, err := s.exportRepo.GetRepostedPosts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := s.userRepo.GetFollowersByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	following, err := s.userRepo.GetFollowingByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := s.exportRepo.GetBlockedUsers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	conversations, err := s.exportRepo.GetConversations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.exportRepo.GetMessages(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.exportRepo.GetSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	loginEvents, err := s.exportRepo.GetLoginEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.exportRepo.GetAccessTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := s.exportRepo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authors of liked and reposted posts
+	var authorIDs []int
+	for _, post := range append(liked, reposted...) {
+		authorIDs = append(authorIDs, post.UserID)
+	}
+	usernames, err := s.exportRepo.GetUsernames(ctx, authorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ownPosts := make([]archivePost, 0, len(*posts))
+	for _, post := range *posts {
+		ownPosts = append(ownPosts, toArchivePost(post, ""))
+	}
+	likedPosts := make([]archivePost, 0, len(liked))
+	for _, post := range liked {
+		likedPosts = append(likedPosts, toArchivePost(post, usernames[post.UserID]))
+	}
+	repostedPosts := make([]archivePost, 0, len(reposted))
+	for _, post := range reposted {
+		repostedPosts = append(repostedPosts, toArchivePost(post, usernames[post.UserID]))
+	}
+
+	return map[string]interface{}{
+		archiveManifestFile: archiveManifest{
+			Format:     archiveFormat,
+			Version:    archiveVersion,
+			ExportedAt: time.Now().UTC(),
+			Username:   user.Username,
+			Excluded:   archiveExclusions,
+		},
+		archiveProfileFile:      toArchiveProfile(user),
+		archivePostsFile:        ownPosts,
+		archiveLikesFile:        likedPosts,
+		archiveRepostsFile:      repostedPosts,
+		archiveFollowersFile:    toArchiveUsers(followers),
+		archiveFollowingFile:    toArchiveUsers(following),
+		archiveBlocksFile:       toArchiveUsers(blocked),
+		archiveMessagesFile:     toArchiveConversations(conversations, messages),
+		archiveSessionsFile:     toArchiveSessions(sessions),
+		archiveLoginEventsFile:  toArchiveLoginEvents(loginEvents),
+		archiveAccessTokensFile: toArchiveAccessTokens(tokens),
+		archiveWebhooksFile:     toArchiveWebhooks(webhooks),
+	}, nil
+}
+
+// sweepArchives removes archives of expired, failed or deleted exports.
+func (s *ExportService) sweepArchives(ctx context.Context) error {
+	exportIDs, err := s.exportRepo.GetDownloadableExportIDs(ctx)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(exportIDs))
+	for _, exportID := range exportIDs {
+		keep[filepath.Base(s.archivePath(exportID))] = true
+	}
+
+	entries, err := os.ReadDir(s.cfg.Export.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // No export built yet
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] || !strings.HasSuffix(entry.Name(), ".zip") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.cfg.Export.Dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ExportService) archivePath(exportID int) string {
+	return filepath.Join(s.cfg.Export.Dir, strconv.Itoa(exportID)+".zip")
+}
+
+// ArchiveName is the file name offered for download.
+func ArchiveName(export *model.DataExport) string {
+	return fmt.Sprintf("x-clone-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/pubsub"
+
+	"gorm.io/gorm"
+)
+
+// Control events of the gateway protocol
+const (
+	EventSubscribed    = "subscribed"
+	EventUnsubscribed  = "unsubscribed" // Also sent when access to the channel is lost
+	EventAuthenticated = "authenticated"
+	EventAuthExpiring  = "auth.expiring" // The client should send a fresh token
+	EventError         = "error"
+)
+
+// GatewaySession is the authentication of a gateway connection, renewed by
+// the client before the access token expires.
+type GatewaySession struct {
+	UserID    int
+	SessionID string
+	Token     string
+	ExpiresAt time.Time
+}
+
+type GatewayService struct {
+	hub              *pubsub.Hub
+	authService      *AuthService
+	postRepo         *repository.PostRepository
+	conversationRepo *repository.ConversationRepository
+	userRepo         *repository.UserRepository
+	cfg              *config.Config
+}
+
+func NewGatewayService(hub *pubsub.Hub, authService *AuthService, postRepo *repository.PostRepository, conversationRepo *repository.ConversationRepository, userRepo *repository.UserRepository, cfg *config.Config) *GatewayService {
+	return &GatewayService{hub: hub, authService: authService, postRepo: postRepo, conversationRepo: conversationRepo, userRepo: userRepo, cfg: cfg}
+}
+
+// Authenticate validates a session access token, personal access tokens are
+// not accepted on the gateway.
+func (s *GatewayService) Authenticate(ctx context.Context, token string) (*GatewaySession, error) {
+	ctx, span := tracer.Start(ctx, "GatewayService.Authenticate")
+	defer span.End()
+
+	if token == "" || strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	claims, err := s.authService.ValidateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+	return &GatewaySession{
+		UserID:    int(claims["user_id"].(float64)),
+		SessionID: claims["sid"].(string),
+		Token:     token,
+		ExpiresAt: expiresAt.Time,
+	}, nil
+}
+
+// Reauthenticate renews the session with a fresh token of the same user, or
+// with an empty token checks the current one is still valid.
+func (s *GatewayService) Reauthenticate(ctx context.Context, session *GatewaySession, token string) error {
+	ctx, span := tracer.Start(ctx, "GatewayService.Reauthenticate")
+	defer span.End()
+
+	if token == "" {
+		token = session.Token
+	}
+	renewed, err := s.Authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	if renewed.UserID != session.UserID {
+		return ErrInvalidToken
+	}
+	*session = *renewed
+	return nil
+}
+
+func (s *GatewayService) Connect(ctx context.Context, userID int) (*pubsub.Client, error) {
+	_, span := tracer.Start(ctx, "GatewayService.Connect")
+	defer span.End()
+
+	if s.hub.Connections(userID) >= s.cfg.Gateway.MaxConnections {
+		return nil, ErrTooManyConnections
+	}
+	return s.hub.Connect(userID), nil
+}
+
+func (s *GatewayService) Disconnect(client *pubsub.Client) {
+	s.hub.Disconnect(client)
+}
+
+// Subscribe adds the client to a channel the user has access to: home, a
+// post:<id> or a conversation:<id> the user takes part in.
+func (s *GatewayService) Subscribe(ctx context.Context, userID int, client *pubsub.Client, channel string) error {
+	ctx, span := tracer.Start(ctx, "GatewayService.Subscribe")
+	defer span.End()
+
+	var postID, conversationID int
+	switch {
+	case channel == ChannelHome:
+		if !s.hub.Subscribe(client, homeTopic(userID)) {
+			return ErrTooManySubscriptions
+		}
+		return nil
+	case scanChannel(channel, channelPost, &postID):
+		if err := s.checkPost(ctx, userID, postID); err != nil {
+			return err
+		}
+	case scanChannel(channel, channelConversation, &conversationID):
+		if _, err := s.conversationRepo.GetConversation(ctx, userID, conversationID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrConversationNotFound
+			}
+			return err
+		}
+	default:
+		return ErrInvalidChannel
+	}
+
+	if !s.hub.Subscribe(client, channel) {
+		return ErrTooManySubscriptions
+	}
+	return nil
+}
+
+// checkPost checks the post exists and its author is visible to the user.
+func (s *GatewayService) checkPost(ctx context.Context, userID, postID int) error {
+	post, err := s.postRepo.GetPostByID(ctx, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
+		}
+		return err
+	}
+	author, err := s.userRepo.GetUserByID(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+	if !author.Visible() {
+		return ErrPostNotFound
+	}
+	blocked, err := s.userRepo.IsBlocked(ctx, userID, author.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+func (s *GatewayService) Unsubscribe(userID int, client *pubsub.Client, channel string) error {
+	topic, err := s.topic(userID, channel)
+	if err != nil {
+		return err
+	}
+	s.hub.Unsubscribe(client, topic)
+	return nil
+}
+
+// Typing tells the other subscribers of a conversation channel the user is typing.
+func (s *GatewayService) Typing(ctx context.Context, userID int, client *pubsub.Client, channel string) error {
+	ctx, span := tracer.Start(ctx, "GatewayService.Typing")
+	defer span.End()
+
+	var conversationID int
+	if !scanChannel(channel, channelConversation, &conversationID) {
+		return ErrInvalidChannel
+	}
+	if !s.hub.Subscribed(client, channel) {
+		return ErrNotSubscribed
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	event := pubsub.Event{Type: EventTyping, Channel: channel, Data: typingEvent{Username: user.Username}}
+	if err := s.hub.Publish(event, client, channel); err != nil {
+		logging.FromContext(ctx).WithError(err).WithField("event", EventTyping).Warn("failed to publish event")
+	}
+	return nil
+}
+
+// Settings returns the gateway configuration the connection handler follows.
+func (s *GatewayService) Settings() config.GatewayConfig {
+	return s.cfg.Gateway
+}
+
+// topic returns the hub topic of a channel.
+func (s *GatewayService) topic(userID int, channel string) (string, error) {
+	var id int
+	switch {
+	case channel == ChannelHome:
+		return homeTopic(userID), nil
+	case scanChannel(channel, channelPost, &id), scanChannel(channel, channelConversation, &id):
+		return channel, nil
+	}
+	return "", ErrInvalidChannel
+}
+
+// scanChannel parses a channel of the format, requiring the canonical form so
+// the channel can be used as its topic.
+func scanChannel(channel, format string, id *int) bool {
+	if _, err := fmt.Sscanf(channel, format, id); err != nil || *id <= 0 {
+		return false
+	}
+	return fmt.Sprintf(format, *id) == channel
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"x-clone/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// CreateGroup starts a group conversation with the creator as its admin.
+func (s *MessageService) CreateGroup(ctx context.Context, creatorID int, name *string, usernames []string) (*model.ConversationResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.CreateGroup")
+	defer span.End()
+
+	creator, err := s.verifiedSender(ctx, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.resolveMembers(ctx, creator, usernames, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(members)+1 > s.cfg.Messages.MaxGroupSize {
+		return nil, ErrGroupTooLarge
+	}
+
+	memberIDs := make([]int, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	conversation := &model.Conversation{Name: name}
+	message := systemMessage(creatorID, "%s created the group", creator.Username)
+	if err := s.conversationRepo.CreateGroup(ctx, conversation, creatorID, memberIDs, message); err != nil {
+		return nil, err
+	}
+	return s.GetConversation(ctx, creatorID, conversation.ConversationID)
+}
+
+// AddParticipants lets a group admin add members, users already in the group are skipped.
+func (s *MessageService) AddParticipants(ctx context.Context, userID, conversationID int, usernames []string) (*model.ConversationResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.AddParticipants")
+	defer span.End()
+
+	conversation, actor, err := s.getGroupAsAdmin(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := s.verifiedSender(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.resolveMembers(ctx, sender, usernames, conversation.Participants)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(members) > 0 {
+		memberIDs := make([]int, 0, len(members))
+		names := make([]string, 0, len(members))
+		for _, member := range members {
+			memberIDs = append(memberIDs, member.UserID)
+			names = append(names, member.Username)
+		}
+		message := systemMessage(userID, "%s added %s", actor.User.Username, strings.Join(names, ", "))
+		// Checked again with the group locked, against concurrent role changes
+		added, err := s.conversationRepo.AddParticipants(ctx, conversationID, userID, memberIDs, s.cfg.Messages.MaxGroupSize, message)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrConversationNotFound
+			}
+			return nil, err
+		}
+		if !added {
+			// Tells a demotion in the meantime from a full group
+			if _, _, err := s.getGroupAsAdmin(ctx, userID, conversationID); err != nil {
+				return nil, err
+			}
+			return nil, ErrGroupTooLarge
+		}
+		message.Sender = actor.User.Username
+		s.events.messageCreated(ctx, message)
+	}
+	return s.GetConversation(ctx, userID, conversationID)
+}
+
+// RemoveParticipant lets a group admin remove a member. Removing yourself leaves the group.
+func (s *MessageService) RemoveParticipant(ctx context.Context, userID, conversationID int, username string) error {
+	ctx, span := tracer.Start(ctx, "MessageService.RemoveParticipant")
+	defer span.End()
+
+	conversation, actor, err := s.getGroup(ctx, userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if actor.User.Username == username {
+		return s.LeaveConversation(ctx, userID, conversationID)
+	}
+	if actor.Role != model.ParticipantAdmin {
+		return ErrNotConversationAdmin
+	}
+
+	target := findParticipant(conversation, func(p *model.ConversationParticipant) bool { return p.User.Username == username })
+	if target == nil {
+		return ErrParticipantNotFound
+	}
+	message := systemMessage(userID, "%s removed %s", actor.User.Username, username)
+	// Checked again with the group locked, against concurrent role changes
+	removed, err := s.conversationRepo.RemoveParticipant(ctx, conversationID, userID, target.UserID, message)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrParticipantNotFound
+		}
+		return err
+	}
+	if !removed {
+		return ErrNotConversationAdmin
+	}
+	s.events.participantRemoved(ctx, conversationID, target.UserID)
+	message.Sender = actor.User.Username
+	s.events.messageCreated(ctx, message)
+	return nil
+}
+
+// LeaveConversation removes the user from a group, its history goes with them.
+func (s *MessageService) LeaveConversation(ctx context.Context, userID, conversationID int) error {
+	ctx, span := tracer.Start(ctx, "MessageService.LeaveConversation")
+	defer span.End()
+
+	conversation, actor, err := s.getGroup(ctx, userID, conversationID)
+	if err != nil {
+		return err
+	}
+	message := systemMessage(userID, "%s left the group", actor.User.Username)
+	if _, err := s.conversationRepo.RemoveParticipant(ctx, conversation.ConversationID, userID, userID, message); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrConversationNotFound
+		}
+		return err
+	}
+	s.events.participantRemoved(ctx, conversation.ConversationID, userID)
+	message.Sender = actor.User.Username
+	s.events.messageCreated(ctx, message)
+	return nil
+}
+
+// RenameConversation sets or, with nil, clears a group's name. Any member may rename.
+func (s *MessageService) RenameConversation(ctx context.Context, userID, conversationID int, name *string) (*model.ConversationResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.RenameConversation")
+	defer span.End()
+
+	_, actor, err := s.getGroup(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	message := systemMessage(userID, "%s removed the group name", actor.User.Username)
+	if name != nil {
+		message = systemMessage(userID, "%s renamed the group to %q", actor.User.Username, *name)
+	}
+	if err := s.conversationRepo.RenameConversation(ctx, conversationID, name, message); err != nil {
+		return nil, err
+	}
+	message.Sender = actor.User.Username
+	s.events.messageCreated(ctx, message)
+	return s.GetConversation(ctx, userID, conversationID)
+}
+
+// SetParticipantRole lets a group admin promote or demote a member.
+func (s *MessageService) SetParticipantRole(ctx context.Context, userID, conversationID int, username, role string) (*model.ConversationResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.SetParticipantRole")
+	defer span.End()
+
+	conversation, _, err := s.getGroupAsAdmin(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	target := findParticipant(conversation, func(p *model.ConversationParticipant) bool { return p.User.Username == username })
+	if target == nil {
+		return nil, ErrParticipantNotFound
+	}
+
+	if target.Role == model.ParticipantAdmin && role != model.ParticipantAdmin {
+		admins := 0
+		for _, participant := range conversation.Participants {
+			if participant.Role == model.ParticipantAdmin {
+				admins++
+			}
+		}
+		if admins == 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	// Checked again with the group locked, against concurrent role changes
+	changed, err := s.conversationRepo.SetParticipantRole(ctx, conversationID, userID, target.UserID, role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrParticipantNotFound
+		}
+		return nil, err
+	}
+	if !changed {
+		if role != model.ParticipantAdmin {
+			return nil, ErrLastAdmin
+		}
+		return nil, ErrNotConversationAdmin
+	}
+	return s.GetConversation(ctx, userID, conversationID)
+}
+
+// getGroup returns a group of the user with the user's participation.
+func (s *MessageService) getGroup(ctx context.Context, userID, conversationID int) (*model.Conversation, *model.ConversationParticipant, error) {
+	conversation, err := s.getConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conversation.Kind != model.ConversationGroup {
+		return nil, nil, ErrNotGroupConversation
+	}
+	actor := findParticipant(conversation, func(p *model.ConversationParticipant) bool { return p.UserID == userID })
+	return conversation, actor, nil
+}
+
+// getGroupAsAdmin is getGroup for actions reserved to admins.
+func (s *MessageService) getGroupAsAdmin(ctx context.Context, userID, conversationID int) (*model.Conversation, *model.ConversationParticipant, error) {
+	conversation, actor, err := s.getGroup(ctx, userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if actor.Role != model.ParticipantAdmin {
+		return nil, nil, ErrNotConversationAdmin
+	}
+	return conversation, actor, nil
+}
+
+// resolveMembers looks up users to add to a group, skipping the inviter and
+// current participants. Invitations are subject to the same checks as direct messages.
+func (s *MessageService) resolveMembers(ctx context.Context, inviter *model.User, usernames []string, participants []model.ConversationParticipant) ([]*model.User, error) {
+	skip := map[string]bool{inviter.Username: true}
+	for _, participant := range participants {
+		skip[participant.User.Username] = true
+	}
+
+	var members []*model.User
+	for _, username := range usernames {
+		if skip[username] {
+			continue
+		}
+		skip[username] = true
+
+		user, err := s.findUser(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.canMessage(ctx, inviter, user); err != nil {
+			return nil, err
+		}
+		members = append(members, user)
+	}
+	return members, nil
+}
+
+func findParticipant(conversation *model.Conversation, match func(p *model.ConversationParticipant) bool) *model.ConversationParticipant {
+	for i := range conversation.Participants {
+		if match(&conversation.Participants[i]) {
+			return &conversation.Participants[i]
+		}
+	}
+	return nil
+}
+
+func systemMessage(actorID int, format string, args ...interface{}) *model.Message {
+	return &model.Message{Kind: model.MessageSystem, SenderID: actorID, Content: fmt.Sprintf(format, args...)}
+}
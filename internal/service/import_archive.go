@@ -0,0 +1,291 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"x-clone/internal/model"
+)
+
+const (
+	importFormatNative  = "x-clone"
+	importFormatTwitter = "twitter"
+)
+
+// Entries are read into memory, cap what all of them decompress to so a zip
+// bomb cannot exhaust it.
+const importArchiveLimit = 256 << 20
+
+// Parse errors are shown to the user as the reason a whole import failed.
+var (
+	errUnrecognizedArchive = errors.New("unrecognized archive format")
+	errUnsupportedVersion  = errors.New("unsupported archive version")
+	errArchiveTooLarge     = errors.New("archive is too large once decompressed")
+)
+
+var (
+	twitterTweetsFile = regexp.MustCompile(`^tweets?(-part\d+)?\.js$`)
+	twitterStatusURL  = regexp.MustCompile(`/status(?:es)?/(\d+)`)
+)
+
+// importData is an archive reduced to what can be recreated.
+type importData struct {
+	Format    string
+	Posts     []importPost
+	Following []string // Usernames
+	Failures  []model.ImportFailure
+}
+
+type importPost struct {
+	Key       string // ID of the post in the archive
+	Content   string
+	CreatedAt time.Time
+	QuoteKey  string // Key of the quoted post, if any
+}
+
+// parseArchive detects the format of an upload: a zip of our own export, a
+// zip of a Twitter archive or a bare tweets.js file.
+func parseArchive(name string) (*importData, error) {
+	zr, err := zip.OpenReader(name)
+	if errors.Is(err, zip.ErrFormat) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		return parseTwitterArchive(map[string][]byte{"tweets.js": data}, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	remaining := int64(importArchiveLimit)
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	if _, ok := files[archiveManifestFile]; ok {
+		return parseNativeArchive(files, &remaining)
+	}
+
+	// Twitter archives keep their data in data/*.js, large ones split in parts
+	var names []string
+	for name := range files {
+		if twitterTweetsFile.MatchString(path.Base(name)) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errUnrecognizedArchive
+	}
+	sort.Strings(names)
+	tweets := make(map[string][]byte, len(names))
+	for _, name := range names {
+		data, err := readZipFile(files[name], &remaining)
+		if err != nil {
+			return nil, err
+		}
+		tweets[name] = data
+	}
+	var following []byte
+	if f, ok := files["data/following.js"]; ok {
+		if following, err = readZipFile(f, &remaining); err != nil {
+			return nil, err
+		}
+	}
+	return parseTwitterArchive(tweets, following)
+}
+
+// readZipFile decompresses an archive file, taking its size from the bytes
+// remaining for the whole archive.
+func readZipFile(f *zip.File, remaining *int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, *remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", f.Name, err)
+	}
+	if int64(len(data)) > *remaining {
+		return nil, errArchiveTooLarge
+	}
+	*remaining -= int64(len(data))
+	return data, nil
+}
+
+// readZipJSON decodes an archive file, missing files are left empty.
+func readZipJSON(files map[string]*zip.File, remaining *int64, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return nil
+	}
+	data, err := readZipFile(f, remaining)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
+
+// parseNativeArchive reads posts and followed users. Likes, reposts and
+// followers refer to other users' posts and choices and are not imported.
+func parseNativeArchive(files map[string]*zip.File, remaining *int64) (*importData, error) {
+	var manifest archiveManifest
+	if err := readZipJSON(files, remaining, archiveManifestFile, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Format != archiveFormat {
+		return nil, errUnrecognizedArchive
+	}
+	if manifest.Version > archiveVersion {
+		return nil, errUnsupportedVersion
+	}
+
+	var posts []archivePost
+	if err := readZipJSON(files, remaining, archivePostsFile, &posts); err != nil {
+		return nil, err
+	}
+	var following []archiveUser
+	if err := readZipJSON(files, remaining, archiveFollowingFile, &following); err != nil {
+		return nil, err
+	}
+
+	data := &importData{Format: importFormatNative}
+	for _, post := range posts {
+		p := importPost{Key: strconv.Itoa(post.PostID), Content: post.Content, CreatedAt: post.CreatedAt}
+		if post.OriginalPostID != nil {
+			p.QuoteKey = strconv.Itoa(*post.OriginalPostID)
+		}
+		data.Posts = append(data.Posts, p)
+	}
+	for _, user := range following {
+		data.Following = append(data.Following, user.Username)
+	}
+	return data, nil
+}
+
+type twitterTweet struct {
+	ID        string `json:"id_str"`
+	FullText  string `json:"full_text"`
+	Text      string `json:"text"` // Older archives
+	CreatedAt string `json:"created_at"`
+	Entities  struct {
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+}
+
+type twitterFollowing struct {
+	Following struct {
+		AccountID string `json:"accountId"`
+	} `json:"following"`
+}
+
+// parseTwitterArchive reads tweets and followed accounts. Retweets are not
+// recreated and followed accounts cannot be resolved since the archive only
+// has their numeric IDs.
+func parseTwitterArchive(tweetFiles map[string][]byte, followingFile []byte) (*importData, error) {
+	var tweets []twitterTweet
+	for name, file := range tweetFiles {
+		var entries []json.RawMessage
+		if err := unmarshalTwitterJS(file, &entries); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		for _, entry := range entries {
+			// Entries are wrapped in {"tweet": {...}} since 2019
+			var wrapped struct {
+				Tweet *twitterTweet `json:"tweet"`
+			}
+			if err := json.Unmarshal(entry, &wrapped); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			if wrapped.Tweet == nil {
+				wrapped.Tweet = &twitterTweet{}
+				if err := json.Unmarshal(entry, wrapped.Tweet); err != nil {
+					return nil, fmt.Errorf("invalid %s: %w", name, err)
+				}
+			}
+			tweets = append(tweets, *wrapped.Tweet)
+		}
+	}
+
+	inArchive := make(map[string]bool, len(tweets))
+	for _, tweet := range tweets {
+		inArchive[tweet.ID] = true
+	}
+
+	data := &importData{Format: importFormatTwitter}
+	for _, tweet := range tweets {
+		item := "post:" + tweet.ID
+		text := tweet.FullText
+		if text == "" {
+			text = tweet.Text
+		}
+		if strings.HasPrefix(text, "RT @") {
+			data.Failures = append(data.Failures, model.ImportFailure{Item: item, Reason: "retweets cannot be imported"})
+			continue
+		}
+		createdAt, err := time.Parse(time.RubyDate, tweet.CreatedAt)
+		if err != nil {
+			data.Failures = append(data.Failures, model.ImportFailure{Item: item, Reason: "invalid created_at"})
+			continue
+		}
+
+		// Links to tweets in the archive become quotes, t.co links are expanded
+		post := importPost{Key: tweet.ID, CreatedAt: createdAt}
+		for _, u := range tweet.Entities.URLs {
+			if m := twitterStatusURL.FindStringSubmatch(u.ExpandedURL); m != nil && inArchive[m[1]] && post.QuoteKey == "" {
+				post.QuoteKey = m[1]
+				text = strings.Replace(text, u.URL, "", 1)
+				continue
+			}
+			if u.URL != "" && u.ExpandedURL != "" {
+				text = strings.Replace(text, u.URL, u.ExpandedURL, 1)
+			}
+		}
+		post.Content = strings.TrimSpace(html.UnescapeString(text))
+		data.Posts = append(data.Posts, post)
+	}
+
+	if followingFile != nil {
+		var following []twitterFollowing
+		if err := unmarshalTwitterJS(followingFile, &following); err != nil {
+			return nil, fmt.Errorf("invalid data/following.js: %w", err)
+		}
+		for _, f := range following {
+			data.Failures = append(data.Failures, model.ImportFailure{
+				Item:   "follow:" + f.Following.AccountID,
+				Reason: "the archive has no username for this account",
+			})
+		}
+	}
+
+	return data, nil
+}
+
+// unmarshalTwitterJS decodes a file like `window.YTD.tweets.part0 = [...]`.
+func unmarshalTwitterJS(file []byte, v interface{}) error {
+	start := bytes.IndexByte(file, '[')
+	if start < 0 {
+		return errUnrecognizedArchive
+	}
+	return json.Unmarshal(file[start:], v)
+}
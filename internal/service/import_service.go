@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Running imports without a heartbeat for this long are assumed abandoned by a
+// crashed worker. Live workers send one every importHeartbeatInterval.
+const (
+	importStaleAfter        = time.Hour
+	importHeartbeatInterval = time.Minute
+)
+
+// Same limit as ContentRequest
+const maxPostLength = 1000
+
+type ImportService struct {
+	importRepo *repository.ImportRepository
+	userRepo   *repository.UserRepository
+	postRepo   *repository.PostRepository
+	jobs       *JobService
+	cfg        *config.Config
+}
+
+func NewImportService(importRepo *repository.ImportRepository, userRepo *repository.UserRepository, postRepo *repository.PostRepository, jobs *JobService, cfg *config.Config) *ImportService {
+	return &ImportService{importRepo: importRepo, userRepo: userRepo, postRepo: postRepo, jobs: jobs, cfg: cfg}
+}
+
+// RequestImport stores the uploaded archive and queues it, one import at a time per user.
+func (s *ImportService) RequestImport(ctx context.Context, userID int, archive io.Reader) (*model.DataImport, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.RequestImport")
+	defer span.End()
+
+	if err := requireVerifiedEmail(ctx, s.userRepo, userID); err != nil {
+		return nil, err
+	}
+	// Spares the upload, CreateImport checks again
+	active, err := s.importRepo.HasActiveImport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		return nil, ErrImportInProgress
+	}
+
+	// SaveUpload
+	if err := os.MkdirAll(s.cfg.Import.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(s.cfg.Import.Dir, "import-*.upload")
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(file, io.LimitReader(archive, s.cfg.Import.MaxSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err == nil && n > s.cfg.Import.MaxSize:
+		err = ErrImportTooLarge
+	case err == nil && n == 0:
+		err = ErrEmptyImport
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	dataImport := &model.DataImport{UserID: userID, Status: model.ImportPending, File: filepath.Base(file.Name())}
+	created, err := s.importRepo.CreateImport(ctx, dataImport)
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if !created {
+		os.Remove(file.Name())
+		return nil, ErrImportInProgress
+	}
+	if _, err := s.jobs.Enqueue(ctx, ProcessImportJob{ImportID: dataImport.DataImportID}); err != nil {
+		// Lets the user start over
+		if err := s.importRepo.FailImport(ctx, dataImport.DataImportID, "failed to queue the import"); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to save import")
+		}
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return dataImport, nil
+}
+
+func (s *ImportService) GetImport(ctx context.Context, userID, importID int) (*model.DataImport, error) {
+	ctx, span := tracer.Start(ctx, "ImportService.GetImport")
+	defer span.End()
+
+	dataImport, err := s.importRepo.GetImport(ctx, userID, importID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, err
+	}
+	return dataImport, nil
+}
+
+// ProcessImportJob recreates the content of an uploaded archive.
+type ProcessImportJob struct {
+	ImportID int `json:"import_id"`
+}
+
+func (ProcessImportJob) JobType() string { return "imports.process" }
+
+// CleanupImportsJob fails the imports abandoned by a crashed worker and removes
+// the uploads no import needs.
+type CleanupImportsJob struct{}
+
+func (CleanupImportsJob) JobType() string { return "imports.cleanup" }
+
+func (s *ImportService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueArchives, s.processImport)
+	RegisterJob(jobs, QueueMaintenance, s.cleanup)
+}
+
+// processImport runs the import once. An interrupted import is not run again
+// since the posts created before would be duplicated, it fails as stale instead.
+func (s *ImportService) processImport(ctx context.Context, job ProcessImportJob) error {
+	dataImport, err := s.importRepo.StartImport(ctx, job.ImportID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Already started, or deleted with its user
+		}
+		return err
+	}
+
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{"import_id": dataImport.DataImportID, "user_id": dataImport.UserID})
+	if err := s.runImport(ctx, dataImport, entry); err != nil {
+		return PermanentJobError(err)
+	}
+	entry.WithFields(logrus.Fields{
+		"status":   dataImport.Status,
+		"imported": dataImport.Imported,
+		"failed":   dataImport.Failed,
+	}).Info("import finished")
+	return nil
+}
+
+func (s *ImportService) cleanup(ctx context.Context, _ CleanupImportsJob) error {
+	if err := s.importRepo.FailStaleImports(ctx, time.Now().Add(-importStaleAfter), "the import was interrupted"); err != nil {
+		return err
+	}
+	return s.sweepUploads(ctx)
+}
+
+// runImport recreates the archive's content. Items that cannot be imported are
+// reported as failures, only an unreadable archive fails the whole import.
+func (s *ImportService) runImport(ctx context.Context, dataImport *model.DataImport, log *logrus.Entry) error {
+	ctx, span := tracer.Start(ctx, "ImportService.runImport")
+	defer span.End()
+
+	path := filepath.Join(s.cfg.Import.Dir, dataImport.File)
+	defer os.Remove(path)
+
+	data, err := parseArchive(path)
+	if err != nil {
+		log.WithError(err).Warn("failed to parse the archive")
+		dataImport.Status = model.ImportFailed
+		dataImport.Error = truncate(err.Error(), 256)
+		return s.importRepo.FinishImport(ctx, dataImport)
+	}
+
+	dataImport.Format = data.Format
+	dataImport.Total = len(data.Posts) + len(data.Following) + len(data.Failures)
+	failures := data.Failures
+	fail := func(item, reason string) {
+		failures = append(failures, model.ImportFailure{Item: truncate(item, 128), Reason: reason})
+	}
+	lastHeartbeat := time.Now()
+	progress := func() error {
+		if time.Since(lastHeartbeat) < importHeartbeatInterval {
+			return nil
+		}
+		lastHeartbeat = time.Now()
+		return s.importRepo.Heartbeat(ctx, dataImport)
+	}
+
+	err = s.importPosts(ctx, dataImport, data.Posts, fail, progress, log)
+	if err == nil {
+		err = s.importFollowing(ctx, dataImport, data.Following, fail, progress, log)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warn("the import was failed as stale, stopping")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range failures {
+		failures[i].DataImportID = dataImport.DataImportID
+	}
+	if err := s.importRepo.AddImportFailures(ctx, failures); err != nil {
+		return err
+	}
+	dataImport.Failed = dataImport.Total - dataImport.Imported
+	dataImport.Status = model.ImportCompleted
+	return s.importRepo.FinishImport(ctx, dataImport)
+}
+
+// importPosts creates posts oldest first with their original timestamps. A quote
+// waits for its quoted post, quotes of posts outside the archive are imported
+// without the quote.
+func (s *ImportService) importPosts(ctx context.Context, dataImport *model.DataImport, posts []importPost, fail func(item, reason string), progress func() error, log *logrus.Entry) error {
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].CreatedAt.Before(posts[j].CreatedAt) })
+
+	inArchive := make(map[string]bool, len(posts))
+	for _, post := range posts {
+		inArchive[post.Key] = true
+	}
+
+	created := make(map[string]int, len(posts)) // Archive key to new post ID
+	skipped := make(map[string]bool)
+	for pending := posts; len(pending) > 0; {
+		var waiting []importPost
+		for _, post := range pending {
+			if err := progress(); err != nil {
+				return err
+			}
+			item := "post:" + post.Key
+			var originalPostID *int
+			if post.QuoteKey != "" {
+				id, ok := created[post.QuoteKey]
+				switch {
+				case ok:
+					originalPostID = &id
+				case inArchive[post.QuoteKey] && !skipped[post.QuoteKey]:
+					waiting = append(waiting, post)
+					continue
+				case inArchive[post.QuoteKey]:
+					fail(item, "the quoted post could not be imported, imported without the quote")
+				default:
+					fail(item, "the quoted post is not in the archive, imported without the quote")
+				}
+			}
+
+			content := strings.TrimSpace(post.Content)
+			switch {
+			case content == "":
+				skipped[post.Key] = true
+				fail(item, "the post is empty")
+				continue
+			case utf8.RuneCountInString(content) > maxPostLength:
+				skipped[post.Key] = true
+				fail(item, "the post is longer than 1000 characters")
+				continue
+			}
+
+			newPost, err := s.postRepo.ImportPost(ctx, &model.Post{
+				UserID:         dataImport.UserID,
+				Content:        content,
+				CreatedAt:      post.CreatedAt,
+				OriginalPostID: originalPostID,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.WithError(err).WithField("item", item).Warn("failed to import post")
+				skipped[post.Key] = true
+				fail(item, "failed to save the post")
+				continue
+			}
+			created[post.Key] = newPost.PostID
+			dataImport.Imported++
+		}
+
+		// Quotes referring to each other in a cycle never become ready
+		if len(waiting) == len(pending) {
+			for _, post := range waiting {
+				fail("post:"+post.Key, "the post quotes itself through other posts")
+			}
+			break
+		}
+		pending = waiting
+	}
+	return nil
+}
+
+// importFollowing follows the archive's followed users by username.
+func (s *ImportService) importFollowing(ctx context.Context, dataImport *model.DataImport, usernames []string, fail func(item, reason string), progress func() error, log *logrus.Entry) error {
+	for _, username := range usernames {
+		if err := progress(); err != nil {
+			return err
+		}
+		item := "follow:" + username
+		user, err := s.userRepo.FindUserByUsername(ctx, username)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.WithError(err).WithField("item", item).Warn("failed to import follow")
+			fail(item, "failed to save the follow")
+			continue
+		}
+		switch {
+		case err != nil || !user.Visible():
+			fail(item, "user not found")
+			continue
+		case user.UserID == dataImport.UserID:
+			fail(item, "you cannot follow yourself")
+			continue
+		}
+
+		blocked, err := s.userRepo.IsBlocked(ctx, dataImport.UserID, user.UserID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.WithError(err).WithField("item", item).Warn("failed to import follow")
+			fail(item, "failed to save the follow")
+			continue
+		}
+		if blocked {
+			fail(item, "user blocked")
+			continue
+		}
+
+		if _, err := s.userRepo.FollowUser(ctx, dataImport.UserID, user.UserID); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.WithError(err).WithField("item", item).Warn("failed to import follow")
+			fail(item, "failed to save the follow")
+			continue
+		}
+		dataImport.Imported++
+	}
+	return nil
+}
+
+// sweepUploads removes uploads left behind by interrupted or failed requests.
+func (s *ImportService) sweepUploads(ctx context.Context) error {
+	files, err := s.importRepo.GetActiveImportFiles(ctx)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[file] = true
+	}
+
+	entries, err := os.ReadDir(s.cfg.Import.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // No upload yet
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] || !strings.HasSuffix(entry.Name(), ".upload") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < importStaleAfter {
+			continue // Possibly still being uploaded
+		}
+		if err := os.Remove(filepath.Join(s.cfg.Import.Dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
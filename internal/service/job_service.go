@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// Queues of the jobs run by this repository
+const (
+	QueueDefault     = "default"
+	QueueArchives    = "archives"    // Exports and imports, long running
+	QueueWebhooks    = "webhooks"    // Deliveries, apart so slow endpoints hold up no other job
+	QueueMaintenance = "maintenance" // Purges and cleanups, mostly scheduled
+)
+
+// jobLeaseGrace is added to the queue timeout for the lease of a running job,
+// so it is only claimed again once its handler gave up.
+const jobLeaseGrace = time.Minute
+
+// JobPayload is the argument of a job, its type selects the handler.
+type JobPayload interface {
+	JobType() string
+}
+
+// permanentError fails a job without further attempts.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// PermanentJobError wraps an error a job cannot recover from by trying again.
+func PermanentJobError(err error) error {
+	return permanentError{err}
+}
+
+type jobDefinition struct {
+	queue  string
+	handle func(ctx context.Context, job *model.Job) error
+}
+
+// JobService queues background jobs in Postgres and runs them in workers,
+// in the API process or in cmd/worker.
+type JobService struct {
+	jobRepo *repository.JobRepository
+	jobs    map[string]jobDefinition
+	cfg     *config.Config
+}
+
+func NewJobService(jobRepo *repository.JobRepository, cfg *config.Config) *JobService {
+	s := &JobService{jobRepo: jobRepo, jobs: make(map[string]jobDefinition), cfg: cfg}
+	RegisterJob(s, QueueMaintenance, s.cleanupJobs)
+	return s
+}
+
+// RegisterJob sets the handler of jobs with payloads of type T and the queue
+// they run on. Jobs must be registered before they are queued or run.
+func RegisterJob[T JobPayload](s *JobService, queue string, handler func(ctx context.Context, payload T) error) {
+	var zero T
+	s.jobs[zero.JobType()] = jobDefinition{
+		queue: queue,
+		handle: func(ctx context.Context, job *model.Job) error {
+			var payload T
+			if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+				return PermanentJobError(fmt.Errorf("decode payload: %w", err))
+			}
+			return handler(ctx, payload)
+		},
+	}
+}
+
+// Enqueue queues a job to run as soon as a worker of its queue is free.
+func (s *JobService) Enqueue(ctx context.Context, payload JobPayload) (*model.Job, error) {
+	return s.Schedule(ctx, payload, time.Now())
+}
+
+// Schedule queues a job to run at runAt.
+func (s *JobService) Schedule(ctx context.Context, payload JobPayload, runAt time.Time) (*model.Job, error) {
+	ctx, span := tracer.Start(ctx, "JobService.Schedule")
+	defer span.End()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.schedule(ctx, payload.JobType(), string(data), runAt, nil)
+}
+
+func (s *JobService) schedule(ctx context.Context, jobType, payload string, runAt time.Time, uniqueKey *string) (*model.Job, error) {
+	definition, ok := s.jobs[jobType]
+	if !ok {
+		return nil, fmt.Errorf("unregistered job type %q", jobType)
+	}
+	job := &model.Job{
+		Queue:     definition.queue,
+		Type:      jobType,
+		Payload:   payload,
+		Status:    model.JobPending,
+		RunAt:     runAt,
+		UniqueKey: uniqueKey,
+	}
+	if err := s.jobRepo.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RequeueDeadJobs retries the dead jobs of the queue, or of every queue if empty.
+func (s *JobService) RequeueDeadJobs(ctx context.Context, queue string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "JobService.RequeueDeadJobs")
+	defer span.End()
+
+	return s.jobRepo.RequeueDeadJobs(ctx, queue)
+}
+
+// RunWorker queues the scheduled jobs and runs the jobs of every configured
+// queue until ctx is done, then waits for the running jobs.
+func (s *JobService) RunWorker(ctx context.Context, log *logrus.Logger) {
+	for jobType, definition := range s.jobs {
+		if _, ok := s.cfg.Jobs.Queues[definition.queue]; !ok {
+			log.WithFields(logrus.Fields{"job": jobType, "queue": definition.queue}).Error("job queue is not configured, its jobs will not run")
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.runScheduler(ctx, log)
+	}()
+	for queue, queueCfg := range s.cfg.Jobs.Queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runQueue(ctx, log, queue, queueCfg)
+		}()
+	}
+	wg.Wait()
+}
+
+type cronEntry struct {
+	jobType  string
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// runScheduler queues a run of each cron job when its time comes. Every run
+// has a unique key, so workers of several processes queue it only once. Runs
+// missed while no worker was up are skipped.
+func (s *JobService) runScheduler(ctx context.Context, log *logrus.Logger) {
+	var entries []*cronEntry
+	now := time.Now().UTC()
+	for jobType, spec := range s.cfg.Jobs.Schedules {
+		entry := log.WithFields(logrus.Fields{"job": jobType, "cron": spec})
+		if _, ok := s.jobs[jobType]; !ok {
+			entry.Error("scheduled job is not registered")
+			continue
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			entry.WithError(err).Error("invalid job schedule")
+			continue
+		}
+		entries = append(entries, &cronEntry{jobType: jobType, schedule: schedule, next: schedule.Next(now)})
+	}
+	if len(entries) == 0 {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].jobType < entries[j].jobType })
+
+	ticker := time.NewTicker(s.cfg.Jobs.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			for _, entry := range entries {
+				if now.Before(entry.next) {
+					continue
+				}
+				key := "cron:" + entry.jobType + ":" + strconv.FormatInt(entry.next.Unix(), 10)
+				if _, err := s.schedule(ctx, entry.jobType, "{}", entry.next, &key); err != nil {
+					if !errors.Is(err, context.Canceled) {
+						log.WithError(err).WithField("job", entry.jobType).Error("failed to schedule job")
+					}
+					continue // Tried again on the next tick
+				}
+				entry.next = entry.schedule.Next(now)
+			}
+		}
+	}
+}
+
+// runQueue claims jobs of the queue while it has free slots.
+func (s *JobService) runQueue(ctx context.Context, log *logrus.Logger, queue string, queueCfg config.JobQueueConfig) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, queueCfg.Concurrency)
+	lease := queueCfg.Timeout + jobLeaseGrace
+
+	ticker := time.NewTicker(s.cfg.Jobs.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			free := cap(slots) - len(slots)
+			if free == 0 {
+				continue
+			}
+			jobs, err := s.jobRepo.ClaimJobs(ctx, queue, free, lease)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.WithError(err).WithField("queue", queue).Error("failed to claim jobs")
+				}
+				continue
+			}
+			for i := range jobs {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func(job *model.Job) {
+					defer wg.Done()
+					defer func() { <-slots }()
+					s.run(ctx, log, job, queueCfg)
+				}(&jobs[i])
+			}
+		}
+	}
+}
+
+// run attempts the job and schedules the next attempt on failure.
+func (s *JobService) run(ctx context.Context, log *logrus.Logger, job *model.Job, queueCfg config.JobQueueConfig) {
+	entry := log.WithFields(logrus.Fields{"job_id": job.JobID, "job": job.Type, "queue": job.Queue, "attempt": job.Attempts})
+	ctx = logging.WithEntry(ctx, entry)
+
+	var err error
+	definition, ok := s.jobs[job.Type]
+	switch {
+	case !ok:
+		err = PermanentJobError(fmt.Errorf("unregistered job type %q", job.Type))
+	case job.Attempts > queueCfg.MaxAttempts:
+		err = PermanentJobError(errors.New("the worker stopped during the last attempt"))
+	default:
+		err = s.attempt(ctx, definition, job, queueCfg.Timeout)
+	}
+
+	// Jobs interrupted by a shutdown are run again without counting the attempt
+	saveCtx := context.WithoutCancel(ctx)
+	if err != nil && ctx.Err() != nil {
+		job.Status = model.JobPending
+		job.Attempts--
+		job.RunAt = time.Now()
+		if err := s.jobRepo.SaveJob(saveCtx, job); err != nil {
+			entry.WithError(err).Error("failed to save job")
+		}
+		return
+	}
+
+	now := time.Now()
+	var permanent permanentError
+	switch {
+	case err == nil:
+		job.Status = model.JobSucceeded
+		job.CompletedAt = &now
+		metrics.JobsTotal.WithLabelValues(job.Queue, job.Type, metrics.JobSucceeded).Inc()
+	case job.Attempts >= queueCfg.MaxAttempts || errors.As(err, &permanent):
+		job.Status = model.JobDead
+		job.LastError = truncate(err.Error(), 512)
+		job.CompletedAt = &now
+		metrics.JobsTotal.WithLabelValues(job.Queue, job.Type, metrics.JobDead).Inc()
+		entry.WithError(err).Error("job failed for good")
+	default:
+		job.Status = model.JobPending
+		job.LastError = truncate(err.Error(), 512)
+		job.RunAt = now.Add(backoff(s.cfg.Jobs.BaseBackoff, s.cfg.Jobs.MaxBackoff, job.Attempts))
+		metrics.JobsTotal.WithLabelValues(job.Queue, job.Type, metrics.JobRetrying).Inc()
+		entry.WithError(err).Warn("job failed, retrying")
+	}
+	if err := s.jobRepo.SaveJob(saveCtx, job); err != nil {
+		entry.WithError(err).Error("failed to save job")
+	}
+}
+
+// attempt runs the handler within the queue timeout, a panic fails the attempt.
+func (s *JobService) attempt(ctx context.Context, definition jobDefinition, job *model.Job, timeout time.Duration) (err error) {
+	ctx, span := tracer.Start(ctx, "JobService.attempt")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		metrics.JobDurationSeconds.WithLabelValues(job.Queue, job.Type).Observe(time.Since(start).Seconds())
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return definition.handle(ctx, job)
+}
+
+// CleanupJobsJob removes finished jobs past their retention.
+type CleanupJobsJob struct{}
+
+func (CleanupJobsJob) JobType() string { return "jobs.cleanup" }
+
+func (s *JobService) cleanupJobs(ctx context.Context, _ CleanupJobsJob) error {
+	now := time.Now()
+	return s.jobRepo.DeleteFinishedJobs(ctx, now.Add(-s.cfg.Jobs.Retention), now.Add(-s.cfg.Jobs.DeadRetention))
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+)
+
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// truncatedUserAgent fits the user agent into the 512 character columns.
+func (c ClientInfo) truncatedUserAgent() string {
+	if len(c.UserAgent) > 512 {
+		return c.UserAgent[:512]
+	}
+	return c.UserAgent
+}
+
+// loginLockout returns how long the account or client IP is still locked out.
+func (s *AuthService) loginLockout(ctx context.Context, keys ...string) (time.Duration, error) {
+	throttles, err := s.authRepo.GetLoginThrottles(ctx, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, throttle := range throttles {
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			retryAfter = max(retryAfter, throttle.LockedUntil.Sub(now))
+		}
+	}
+	return retryAfter, nil
+}
+
+// loginFailed counts the failure against the account and the client IP and
+// locks them out with exponential backoff once over the limit.
+func (s *AuthService) loginFailed(ctx context.Context, user *model.User, userKey, ipKey string, client ClientInfo, reason string) error {
+	metrics.LoginsTotal.WithLabelValues(metrics.LoginFailed).Inc()
+	if user != nil {
+		s.recordLoginEvent(ctx, user.UserID, client, false, reason)
+	}
+
+	cfg := s.cfg.LoginProtection
+	for key, limit := range map[string]int{userKey: cfg.MaxFailures, ipKey: cfg.IPMaxFailures} {
+		throttle, err := s.authRepo.IncrementLoginFailures(ctx, key, cfg.FailureWindow)
+		if err != nil {
+			return err
+		}
+		if limit <= 0 || throttle.Failures < limit {
+			continue
+		}
+		if err := s.authRepo.LockLogin(ctx, key, time.Now().Add(backoff(cfg.BaseLockout, cfg.MaxLockout, throttle.Failures-limit+1))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordLoginEvent is best effort, a failed insert must not fail the login.
+func (s *AuthService) recordLoginEvent(ctx context.Context, userID int, client ClientInfo, success bool, reason string) {
+	event := &model.LoginEvent{
+		UserID:    userID,
+		IP:        client.IP,
+		UserAgent: client.truncatedUserAgent(),
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := s.authRepo.CreateLoginEvent(ctx, event); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("failed to record login event")
+	}
+}
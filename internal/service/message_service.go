@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/pubsub"
+
+	"gorm.io/gorm"
+)
+
+type MessageService struct {
+	conversationRepo *repository.ConversationRepository
+	userRepo         *repository.UserRepository
+	events           publisher
+	cfg              *config.Config
+}
+
+func NewMessageService(conversationRepo *repository.ConversationRepository, userRepo *repository.UserRepository, hub *pubsub.Hub, cfg *config.Config) *MessageService {
+	return &MessageService{conversationRepo: conversationRepo, userRepo: userRepo, events: publisher{hub: hub, userRepo: userRepo}, cfg: cfg}
+}
+
+// SendDirectMessage messages a user, starting the conversation on the first message.
+func (s *MessageService) SendDirectMessage(ctx context.Context, senderID int, username, content string) (*model.Message, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.SendDirectMessage")
+	defer span.End()
+
+	recipient, err := s.findUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.UserID == senderID {
+		return nil, ErrSelfMessage
+	}
+	sender, err := s.verifiedSender(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.canMessage(ctx, sender, recipient); err != nil {
+		return nil, err
+	}
+
+	message := &model.Message{Kind: model.MessageText, SenderID: senderID, Content: content}
+	if err := s.conversationRepo.SendDirectMessage(ctx, directKey(senderID, recipient.UserID), senderID, recipient.UserID, message); err != nil {
+		return nil, err
+	}
+	message.Sender = sender.Username
+	s.events.messageCreated(ctx, message)
+	return message, nil
+}
+
+// SendMessage adds a message to a conversation the sender takes part in.
+func (s *MessageService) SendMessage(ctx context.Context, senderID, conversationID int, content string) (*model.Message, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.SendMessage")
+	defer span.End()
+
+	conversation, err := s.getConversation(ctx, senderID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := s.verifiedSender(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Direct messages are checked against the recipient, groups only require membership
+	if conversation.Kind == model.ConversationDirect {
+		if len(conversation.Participants) < 2 {
+			return nil, ErrCannotMessage // The recipient deleted their account
+		}
+		for _, participant := range conversation.Participants {
+			if participant.UserID == senderID {
+				continue
+			}
+			if err := s.canMessage(ctx, sender, &participant.User); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	message := &model.Message{ConversationID: conversationID, Kind: model.MessageText, SenderID: senderID, Content: content}
+	if err := s.conversationRepo.CreateMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	message.Sender = sender.Username
+	s.events.messageCreated(ctx, message)
+	return message, nil
+}
+
+func (s *MessageService) findUser(ctx context.Context, username string) (*model.User, error) {
+	user, err := s.userRepo.FindUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !user.Visible() {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// verifiedSender returns the sender, who needs a verified email to message anyone.
+func (s *MessageService) verifiedSender(ctx context.Context, senderID int) (*model.User, error) {
+	sender, err := s.userRepo.GetUserByID(ctx, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if sender.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	return sender, nil
+}
+
+// canMessage checks neither user blocked the other and the recipient's
+// dm_permission lets the sender in, for direct messages and group invitations.
+func (s *MessageService) canMessage(ctx context.Context, sender, recipient *model.User) error {
+	if !recipient.Visible() {
+		return ErrCannotMessage
+	}
+
+	blocked, err := s.userRepo.IsBlocked(ctx, sender.UserID, recipient.UserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrCannotMessage
+	}
+
+	if recipient.DMPermission == model.DMPermissionFollowing {
+		following, err := s.userRepo.IsFollowing(ctx, recipient.UserID, sender.UserID)
+		if err != nil {
+			return err
+		}
+		if !following {
+			return ErrCannotMessage
+		}
+	}
+	return nil
+}
+
+// GetConversations returns a page of the user's conversations, latest activity first.
+func (s *MessageService) GetConversations(ctx context.Context, userID int, cursor string, limit int) ([]model.ConversationResponse, string, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.GetConversations")
+	defer span.End()
+
+	beforeAt, beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	conversations, err := s.conversationRepo.GetConversations(ctx, userID, beforeAt, beforeID, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	responses, err := s.toConversationResponses(ctx, userID, conversations)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(conversations) == limit {
+		last := conversations[len(conversations)-1]
+		next = encodeCursor(last.LastMessageAt, last.ConversationID)
+	}
+	return responses, next, nil
+}
+
+func (s *MessageService) GetConversation(ctx context.Context, userID, conversationID int) (*model.ConversationResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.GetConversation")
+	defer span.End()
+
+	conversation, err := s.getConversation(ctx, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.toConversationResponses(ctx, userID, []model.Conversation{*conversation})
+	if err != nil {
+		return nil, err
+	}
+	return &responses[0], nil
+}
+
+// GetMessages returns a page of the conversation's messages, newest first.
+func (s *MessageService) GetMessages(ctx context.Context, userID, conversationID int, cursor string, limit int) ([]model.Message, string, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.GetMessages")
+	defer span.End()
+
+	_, beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := s.getConversation(ctx, userID, conversationID); err != nil {
+		return nil, "", err
+	}
+	messages, err := s.conversationRepo.GetMessages(ctx, userID, conversationID, beforeID, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(messages) == limit {
+		last := messages[len(messages)-1]
+		next = encodeCursor(last.CreatedAt, last.MessageID)
+	}
+	return messages, next, nil
+}
+
+// MarkConversationRead sets the user's read receipt to the latest message.
+func (s *MessageService) MarkConversationRead(ctx context.Context, userID, conversationID int) error {
+	ctx, span := tracer.Start(ctx, "MessageService.MarkConversationRead")
+	defer span.End()
+
+	if _, err := s.getConversation(ctx, userID, conversationID); err != nil {
+		return err
+	}
+	return s.conversationRepo.MarkConversationRead(ctx, userID, conversationID)
+}
+
+// DeleteMessage hides a message for the user, other participants still see it.
+func (s *MessageService) DeleteMessage(ctx context.Context, userID, conversationID, messageID int) error {
+	ctx, span := tracer.Start(ctx, "MessageService.DeleteMessage")
+	defer span.End()
+
+	if _, err := s.getConversation(ctx, userID, conversationID); err != nil {
+		return err
+	}
+	if err := s.conversationRepo.DeleteMessageForUser(ctx, userID, conversationID, messageID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMessageNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MessageService) getConversation(ctx context.Context, userID, conversationID int) (*model.Conversation, error) {
+	conversation, err := s.conversationRepo.GetConversation(ctx, userID, conversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func (s *MessageService) toConversationResponses(ctx context.Context, userID int, conversations []model.Conversation) ([]model.ConversationResponse, error) {
+	responses := make([]model.ConversationResponse, 0, len(conversations))
+	if len(conversations) == 0 {
+		return responses, nil
+	}
+
+	ids := make([]int, 0, len(conversations))
+	for _, conversation := range conversations {
+		ids = append(ids, conversation.ConversationID)
+	}
+	lastMessages, err := s.conversationRepo.GetLastMessages(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := s.conversationRepo.GetUnreadCounts(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, conversation := range conversations {
+		participants := make([]model.ParticipantResponse, 0, len(conversation.Participants))
+		for _, participant := range conversation.Participants {
+			participants = append(participants, model.ParticipantResponse{
+				Username:          participant.User.Username,
+				FirstName:         participant.User.FirstName,
+				LastName:          participant.User.LastName,
+				Role:              participant.Role,
+				LastReadMessageID: participant.LastReadMessageID,
+			})
+		}
+		responses = append(responses, model.ConversationResponse{
+			ConversationID: conversation.ConversationID,
+			Kind:           conversation.Kind,
+			Name:           conversation.Name,
+			Participants:   participants,
+			LastMessage:    lastMessages[conversation.ConversationID],
+			LastMessageAt:  conversation.LastMessageAt,
+			Unread:         unread[conversation.ConversationID],
+		})
+	}
+	return responses, nil
+}
+
+func directKey(userID, otherID int) string {
+	return fmt.Sprintf("%d:%d", min(userID, otherID), max(userID, otherID))
+}
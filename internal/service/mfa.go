@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/pkg/utils/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaTokenType = "mfa"
+	totpSkew     = 1 // Steps of clock drift accepted on either side
+)
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID int) (*TOTPEnrollment, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.EnrollTOTP")
+	defer span.End()
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.mfaEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, s.cfg.MFA.Issuer, user.Username),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves the app is set up and returns
+// the recovery codes. They are only stored hashed, so this is the only time
+// they can be shown.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID int, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ConfirmTOTP")
+	defer span.End()
+
+	userTOTP, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	if userTOTP.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := make([]string, s.cfg.MFA.RecoveryCodes)
+	hashes := make([]string, len(codes))
+	for i := range codes {
+		if codes[i], err = generateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := s.mfaRepo.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *AuthService) DisableTOTP(ctx context.Context, userID int, code string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.DisableTOTP")
+	defer span.End()
+
+	ok, err := s.verifySecondFactor(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return s.mfaRepo.DisableTOTP(ctx, userID)
+}
+
+// VerifyMFALogin exchanges the challenge token issued by Login and a TOTP or
+// recovery code for an access token.
+func (s *AuthService) VerifyMFALogin(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.VerifyMFALogin")
+	defer span.End()
+
+	userID, err := s.validateMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+	if !s.canReactivate(user) {
+		return nil, ErrInvalidMFAToken
+	}
+
+	userKey, ipKey := "user:"+user.Username, "ip:"+client.IP
+
+	// Check lockout, codes are short enough to brute force otherwise
+	retryAfter, err := s.loginLockout(ctx, userKey, ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter > 0 {
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	ok, err := s.verifySecondFactor(ctx, userID, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.loginFailed(ctx, user, userKey, ipKey, client, "invalid_mfa_code"); err != nil {
+			return nil, err
+		}
+		return nil, ErrMFAFailed
+	}
+
+	return s.loginSucceeded(ctx, user, userKey, client)
+}
+
+func (s *AuthService) mfaEnabled(ctx context.Context, userID int) (bool, error) {
+	userTOTP, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return userTOTP.Enabled, nil
+}
+
+// verifySecondFactor accepts a current TOTP code, once, or an unused recovery code.
+func (s *AuthService) verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	userTOTP, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, ErrMFANotEnrolled
+		}
+		return false, err
+	}
+	if !userTOTP.Enabled {
+		return false, ErrMFANotEnrolled
+	}
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(userTOTP.Secret, code, time.Now(), totpSkew)
+		if !ok {
+			return false, nil
+		}
+		return s.mfaRepo.UseTOTPStep(ctx, userID, step)
+	}
+
+	return s.mfaRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+}
+
+func (s *AuthService) generateMFAToken(user *model.User) (string, error) {
+	claims := jwt.MapClaims{
+		"typ":     mfaTokenType,
+		"user_id": user.UserID,
+		"exp":     time.Now().Add(s.cfg.MFA.ChallengeTTL).Unix(),
+	}
+
+	return s.keys.Sign(claims)
+}
+
+func (s *AuthService) validateMFAToken(ctx context.Context, tokenString string) (int, error) {
+	claims, err := s.keys.Parse(ctx, tokenString)
+	if err != nil || claims["typ"] != mfaTokenType {
+		return 0, ErrInvalidMFAToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidMFAToken
+	}
+
+	return int(userID), nil
+}
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b)) // 16 chars
+	return code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DomainEventHandler reacts to a domain event, data being its decoded payload.
+// Events are dispatched at least once: a handler sees an event again when a
+// handler of it fails or the relay dies, so it must be idempotent.
+type DomainEventHandler func(ctx context.Context, event *model.OutboxEvent, data model.DomainEvent) error
+
+type outboxSubscriber struct {
+	name   string
+	handle DomainEventHandler
+}
+
+// OutboxService relays the domain events recorded in the outbox to in-process
+// subscribers, in order per aggregate.
+type OutboxService struct {
+	outboxRepo  *repository.OutboxRepository
+	subscribers map[string][]outboxSubscriber
+	cfg         *config.Config
+}
+
+func NewOutboxService(outboxRepo *repository.OutboxRepository, cfg *config.Config) *OutboxService {
+	return &OutboxService{outboxRepo: outboxRepo, subscribers: make(map[string][]outboxSubscriber), cfg: cfg}
+}
+
+// Subscribe registers the handler for the event types. Subscribers must be
+// registered before the relay runs.
+func (s *OutboxService) Subscribe(name string, handler DomainEventHandler, eventTypes ...string) {
+	for _, eventType := range eventTypes {
+		s.subscribers[eventType] = append(s.subscribers[eventType], outboxSubscriber{name: name, handle: handler})
+	}
+}
+
+// RunWorker dispatches due events until ctx is done.
+func (s *OutboxService) RunWorker(ctx context.Context, log *logrus.Logger) {
+	ticker := time.NewTicker(s.cfg.Outbox.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.processEvents(ctx, log); err != nil && !errors.Is(err, context.Canceled) {
+				log.WithError(err).Error("failed to process outbox events")
+			}
+		}
+	}
+}
+
+// CleanupOutboxJob removes processed events past their retention.
+type CleanupOutboxJob struct{}
+
+func (CleanupOutboxJob) JobType() string { return "outbox.cleanup" }
+
+func (s *OutboxService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueMaintenance, s.cleanup)
+}
+
+func (s *OutboxService) cleanup(ctx context.Context, _ CleanupOutboxJob) error {
+	return s.outboxRepo.DeleteProcessedEvents(ctx, time.Now().Add(-s.cfg.Outbox.Retention))
+}
+
+func (s *OutboxService) processEvents(ctx context.Context, log *logrus.Logger) error {
+	for {
+		events, err := s.outboxRepo.ClaimEvents(ctx, s.cfg.Outbox.BatchSize, s.cfg.Outbox.Lease)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		// Events of an aggregate are dispatched one after the other, aggregates in parallel
+		var aggregates [][]*model.OutboxEvent
+		index := make(map[string]int)
+		for i := range events {
+			key := fmt.Sprintf("%s:%d", events[i].AggregateType, events[i].AggregateID)
+			n, ok := index[key]
+			if !ok {
+				n = len(aggregates)
+				index[key] = n
+				aggregates = append(aggregates, nil)
+			}
+			aggregates[n] = append(aggregates[n], &events[i])
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, s.cfg.Outbox.Concurrency)
+		for _, aggregate := range aggregates {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(events []*model.OutboxEvent) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				for _, event := range events {
+					if !s.dispatch(ctx, log, event) {
+						break // Later events wait for the retry
+					}
+				}
+			}(aggregate)
+		}
+		wg.Wait()
+
+		if len(events) < s.cfg.Outbox.BatchSize {
+			return nil
+		}
+	}
+}
+
+// dispatch hands the event to its subscribers and reports whether the
+// aggregate's later events may follow it.
+func (s *OutboxService) dispatch(ctx context.Context, log *logrus.Logger, event *model.OutboxEvent) bool {
+	entry := log.WithFields(logrus.Fields{"outbox_event_id": event.OutboxEventID, "event": event.Type, "aggregate": fmt.Sprintf("%s:%d", event.AggregateType, event.AggregateID)})
+	ctx = logging.WithEntry(ctx, entry)
+
+	err := s.handle(ctx, event)
+	if err == nil {
+		metrics.OutboxEventsTotal.WithLabelValues(event.Type, metrics.DeliverySucceeded).Inc()
+		metrics.OutboxLagSeconds.Observe(time.Since(event.CreatedAt).Seconds())
+		if err := s.outboxRepo.MarkProcessed(ctx, event.OutboxEventID); err != nil {
+			entry.WithError(err).Error("failed to save outbox event")
+			return false
+		}
+		return true
+	}
+
+	event.Attempts++
+	event.LastError = truncate(err.Error(), 256)
+	if event.Attempts >= s.cfg.Outbox.MaxAttempts {
+		now := time.Now()
+		event.Status = model.OutboxFailed
+		event.ProcessedAt = &now
+		metrics.OutboxEventsTotal.WithLabelValues(event.Type, metrics.DeliveryFailed).Inc()
+		entry.WithError(err).Error("gave up on outbox event")
+	} else {
+		event.NextAttemptAt = time.Now().Add(backoff(s.cfg.Outbox.BaseBackoff, s.cfg.Outbox.MaxBackoff, event.Attempts))
+		metrics.OutboxEventsTotal.WithLabelValues(event.Type, metrics.DeliveryRetrying).Inc()
+		entry.WithError(err).WithField("attempt", event.Attempts).Warn("failed to dispatch outbox event")
+	}
+	if err := s.outboxRepo.SaveFailure(ctx, event); err != nil {
+		entry.WithError(err).Error("failed to save outbox event")
+		return false
+	}
+	return event.Status == model.OutboxFailed
+}
+
+func (s *OutboxService) handle(ctx context.Context, event *model.OutboxEvent) error {
+	subscribers := s.subscribers[event.Type]
+	if len(subscribers) == 0 {
+		return nil
+	}
+	data, err := model.DecodeDomainEvent(event)
+	if err != nil {
+		return err
+	}
+	for _, subscriber := range subscribers {
+		if err := subscriber.handle(ctx, event, data); err != nil {
+			return fmt.Errorf("%s: %w", subscriber.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// Cursors are opaque to clients: the sort key and ID of the last item of a page.
+func encodeCursor(at time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d_%d", at.UnixNano(), id))
+}
+
+// decodeCursor returns a zero ID for an empty cursor, the first page.
+func decodeCursor(cursor string) (time.Time, int, error) {
+	if cursor == "" {
+		return time.Time{}, 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	var nanos int64
+	var id int
+	if _, err := fmt.Sscanf(string(raw), "%d_%d", &nanos, &id); err != nil || id <= 0 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nanos), id, nil
+}
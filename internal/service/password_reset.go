@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/mailer"
+	"x-clone/pkg/utils/hash"
+
+	"gorm.io/gorm"
+)
+
+const mailTimeout = 30 * time.Second
+
+// ForgotPassword emails a reset link if the address belongs to an account.
+// The work happens in the background so neither the response nor its timing
+// tells whether the address is registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) {
+	ctx, span := tracer.Start(ctx, "AuthService.ForgotPassword")
+	defer span.End()
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+		defer cancel()
+
+		if err := s.sendPasswordReset(ctx, normalizeEmail(email)); err != nil {
+			logging.FromContext(ctx).WithError(err).Error("failed to send password reset email")
+		}
+	}()
+}
+
+func (s *AuthService) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, tokenHash, err := generateSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := s.authRepo.CreatePasswordResetToken(ctx, &model.PasswordResetToken{
+		UserID:    user.UserID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(s.cfg.PasswordReset.TokenTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your X-clone password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can be used once.\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			user.FirstName,
+			s.cfg.PasswordReset.TokenTTL,
+			fmt.Sprintf(s.cfg.PasswordReset.URL, token)),
+	})
+}
+
+// ResetPassword sets a new password with an emailed token and signs out every session.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer span.End()
+
+	hashedPassword, err := hash.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	userID, err := s.authRepo.ResetPassword(ctx, hashSecretToken(token), hashedPassword)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	logging.FromContext(ctx).WithField("user_id", userID).Info("password reset")
+	return nil
+}
+
+func generateSecretToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
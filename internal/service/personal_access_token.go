@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/pkg/logging"
+
+	"gorm.io/gorm"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs.
+const PersonalAccessTokenPrefix = "xpat_"
+
+// Uses within this interval of the last one do not update last_used_at.
+const tokenTouchInterval = time.Minute
+
+// CreatePersonalAccessToken returns the plaintext token, which is not stored
+// and cannot be shown again.
+func (s *AuthService) CreatePersonalAccessToken(ctx context.Context, userID int, name string, scopes []string, expiresIn time.Duration) (string, *model.PersonalAccessToken, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.CreatePersonalAccessToken")
+	defer span.End()
+
+	secret, _, err := generateSecretToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := PersonalAccessTokenPrefix + secret
+
+	pat := &model.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(PersonalAccessTokenPrefix)+4],
+		TokenHash: hashSecretToken(token),
+		Scopes:    scopes,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		pat.ExpiresAt = &expiresAt
+	}
+	if err := s.tokenRepo.CreateToken(ctx, pat); err != nil {
+		return "", nil, err
+	}
+	return token, pat, nil
+}
+
+func (s *AuthService) GetPersonalAccessTokens(ctx context.Context, userID int) ([]model.PersonalAccessToken, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetPersonalAccessTokens")
+	defer span.End()
+
+	return s.tokenRepo.GetTokens(ctx, userID)
+}
+
+func (s *AuthService) RevokePersonalAccessToken(ctx context.Context, userID, tokenID int) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokePersonalAccessToken")
+	defer span.End()
+
+	if err := s.tokenRepo.RevokeToken(ctx, userID, tokenID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTokenNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AuthService) ValidatePersonalAccessToken(ctx context.Context, token string) (*model.PersonalAccessToken, error) {
+	if !strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	pat, err := s.tokenRepo.GetActiveTokenByHash(ctx, hashSecretToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	// Best effort, a failed update must not reject the request
+	now := time.Now()
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= tokenTouchInterval {
+		if err := s.tokenRepo.TouchToken(ctx, pat.PersonalAccessTokenID, now); err != nil {
+			logging.FromContext(ctx).WithError(err).Warn("failed to update token last_used_at")
+		}
+	}
+	return pat, nil
+}
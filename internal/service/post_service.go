@@ -1,9 +1,14 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"x-clone/internal/model"
 	"x-clone/internal/repository"
+	"x-clone/pkg/eventbus"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+	"x-clone/pkg/pubsub"
 
 	"gorm.io/gorm"
 )
@@ -11,123 +16,183 @@ import (
 type PostService struct {
 	postRepo *repository.PostRepository
 	userRepo *repository.UserRepository
+	events   publisher
 }
 
-func NewPostService(postRepo *repository.PostRepository, userRepo *repository.UserRepository) *PostService {
-	return &PostService{postRepo: postRepo, userRepo: userRepo}
+func NewPostService(postRepo *repository.PostRepository, userRepo *repository.UserRepository, bus *eventbus.Bus, hub *pubsub.Hub) *PostService {
+	return &PostService{postRepo: postRepo, userRepo: userRepo, events: publisher{bus: bus, hub: hub, userRepo: userRepo}}
 }
 
-func (s *PostService) CreatePost(post *model.Post) (*model.Post, error) {
-	newPost, err := s.postRepo.CreatePost(post)
+func (s *PostService) CreatePost(ctx context.Context, post *model.Post) (*model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.CreatePost")
+	defer span.End()
+
+	if err := requireVerifiedEmail(ctx, s.userRepo, post.UserID); err != nil {
+		return nil, err
+	}
+	newPost, err := s.postRepo.CreatePost(ctx, post)
 	if err != nil {
-		return nil, errors.New("failed to create post")
+		return nil, err
 	}
+	metrics.PostsCreatedTotal.Inc()
+	s.events.postCreated(ctx, newPost)
 	return newPost, nil
 }
 
-func (s *PostService) GetUserPosts(userID int) (*[]model.Post, error) {
-	posts, err := s.postRepo.GetUserPosts(userID)
+func (s *PostService) GetUserPosts(ctx context.Context, userID int) (*[]model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetUserPosts")
+	defer span.End()
+
+	posts, err := s.postRepo.GetUserPosts(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 	return posts, nil
 }
 
-func (s *PostService) GetUserPostByID(userID, postID int) (*model.Post, error) {
-	post, err := s.postRepo.GetUserPostByID(userID, postID)
+func (s *PostService) GetUserPostByID(ctx context.Context, userID, postID int) (*model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetUserPostByID")
+	defer span.End()
+
+	post, err := s.postRepo.GetUserPostByID(ctx, userID, postID)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("post not found")
-		} else {
-			return nil, err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
 		}
+		return nil, err
 	}
 	return post, nil
 }
 
-func (s *PostService) UpdatePostContentByID(userID, postID int, content string) (*model.Post, error) {
-	updatedPost, err := s.postRepo.UpdatePostContentByID(userID, postID, content)
+// notifyAuthor tells the author of the post and the post's channel about a new
+// like or repost.
+func (s *PostService) notifyAuthor(ctx context.Context, userID, postID int, eventType string) {
+	if s.events.idle() {
+		return
+	}
+	post, err := s.postRepo.GetPostByID(ctx, postID)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("post not found")
-		} else {
-			return nil, err
+		logging.FromContext(ctx).WithError(err).WithField("event", eventType).Warn("failed to publish event")
+		return
+	}
+	s.events.postInteraction(ctx, userID, post, eventType)
+}
+
+func (s *PostService) UpdatePostContentByID(ctx context.Context, userID, postID int, content string) (*model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.UpdatePostContentByID")
+	defer span.End()
+
+	updatedPost, err := s.postRepo.UpdatePostContentByID(ctx, userID, postID, content)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
 		}
+		return nil, err
 	}
 	return updatedPost, err
 }
 
-func (s *PostService) DeletePostByID(userID, postID int) error {
-	if err := s.postRepo.DeletePostByID(userID, postID); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("post not found")
-		} else {
-			return err
+func (s *PostService) DeletePostByID(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.DeletePostByID")
+	defer span.End()
+
+	if err := s.postRepo.DeletePostByID(ctx, userID, postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
 		}
+		return err
 	}
 	return nil
 }
 
-func (s *PostService) LikePost(userID, postID int) error {
-	if err := s.postRepo.LikePost(userID, postID); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("post not found")
-		} else {
-			return err
+func (s *PostService) LikePost(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.LikePost")
+	defer span.End()
+
+	liked, err := s.postRepo.LikePost(ctx, userID, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
 		}
+		return err
+	}
+	if liked {
+		metrics.LikesTotal.Inc()
+		s.notifyAuthor(ctx, userID, postID, EventPostLiked)
 	}
 	return nil
 }
 
-func (s *PostService) UnlikePost(userID, postID int) error {
-	if err := s.postRepo.UnlikePost(userID, postID); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("post not found")
-		} else {
-			return err
+func (s *PostService) UnlikePost(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.UnlikePost")
+	defer span.End()
+
+	if err := s.postRepo.UnlikePost(ctx, userID, postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
 		}
+		return err
 	}
 	return nil
 }
 
-func (s *PostService) RepostPost(userID, postID int) error {
-	if err := s.postRepo.RepostPost(userID, postID); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("post not found")
-		} else {
-			return err
+func (s *PostService) RepostPost(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.RepostPost")
+	defer span.End()
+
+	reposted, err := s.postRepo.RepostPost(ctx, userID, postID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
 		}
+		return err
+	}
+	if reposted {
+		s.notifyAuthor(ctx, userID, postID, EventPostReposted)
 	}
 	return nil
 }
 
-func (s *PostService) UndoRepostPost(userID, postID int) error {
-	if err := s.postRepo.UndoRepostPost(userID, postID); err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return errors.New("post not found")
-		} else {
-			return err
+func (s *PostService) UndoRepostPost(ctx context.Context, userID, postID int) error {
+	ctx, span := tracer.Start(ctx, "PostService.UndoRepostPost")
+	defer span.End()
+
+	if err := s.postRepo.UndoRepostPost(ctx, userID, postID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPostNotFound
 		}
+		return err
 	}
 	return nil
 }
 
-func (s *PostService) GetUserReposts(userID int) (*[]model.Post, error) {
-	reposts, err := s.postRepo.GetUserReposts(userID)
+func (s *PostService) GetUserReposts(ctx context.Context, userID int) (*[]model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.GetUserReposts")
+	defer span.End()
+
+	reposts, err := s.postRepo.GetUserReposts(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 	return reposts, nil
 }
 
-func (s *PostService) QuotePost(userID, postID int, content string) (*model.Post, error) {
-	post, err := s.postRepo.QuotePost(userID, postID, content)
+func (s *PostService) QuotePost(ctx context.Context, userID, postID int, content string) (*model.Post, error) {
+	ctx, span := tracer.Start(ctx, "PostService.QuotePost")
+	defer span.End()
+
+	if err := requireVerifiedEmail(ctx, s.userRepo, userID); err != nil {
+		return nil, err
+	}
+	post, err := s.postRepo.QuotePost(ctx, userID, postID, content)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("post not found")
-		} else {
-			return nil, err
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
 		}
+		return nil, err
 	}
+	metrics.PostsCreatedTotal.Inc()
+	s.events.postCreated(ctx, post)
+	s.events.postQuoted(ctx, post)
 	return post, nil
 }
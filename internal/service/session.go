@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+	"x-clone/internal/model"
+	"x-clone/pkg/logging"
+
+	"gorm.io/gorm"
+)
+
+// Requests within this interval of the last one do not update last_seen_at.
+const sessionTouchInterval = time.Minute
+
+func (s *AuthService) GetSessions(ctx context.Context, userID int, currentSessionID string) ([]model.Session, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetSessions")
+	defer span.End()
+
+	sessions, err := s.sessionRepo.GetActiveSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeSession")
+	defer span.End()
+
+	if err := s.sessionRepo.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID int, currentSessionID string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeOtherSessions")
+	defer span.End()
+
+	return s.sessionRepo.RevokeOtherSessions(ctx, userID, currentSessionID)
+}
+
+// startSession records a sign-in and returns an access token bound to it.
+func (s *AuthService) startSession(ctx context.Context, user *model.User, client ClientInfo) (string, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := s.sessionRepo.CreateSession(ctx, &model.Session{
+		SessionID:  sessionID,
+		UserID:     user.UserID,
+		IP:         client.IP,
+		UserAgent:  client.truncatedUserAgent(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.cfg.JWT.AccessTokenTTL),
+	}); err != nil {
+		return "", err
+	}
+
+	return s.GenerateAccessToken(user, sessionID)
+}
+
+// touchSession is best effort, a failed update must not reject the request.
+func (s *AuthService) touchSession(ctx context.Context, session *model.Session) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+	if err := s.sessionRepo.TouchSession(ctx, session.SessionID, now); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("failed to update session last_seen_at")
+	}
+}
+
+func generateSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
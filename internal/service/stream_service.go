@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/pkg/eventbus"
+)
+
+type StreamService struct {
+	bus         *eventbus.Bus
+	authService *AuthService
+	cfg         *config.Config
+}
+
+func NewStreamService(bus *eventbus.Bus, authService *AuthService, cfg *config.Config) *StreamService {
+	return &StreamService{bus: bus, authService: authService, cfg: cfg}
+}
+
+// CheckSession validates the access token a stream was opened with and returns
+// its expiry. It fails with ErrInvalidToken once the session is revoked.
+func (s *StreamService) CheckSession(ctx context.Context, token string) (time.Time, error) {
+	ctx, span := tracer.Start(ctx, "StreamService.CheckSession")
+	defer span.End()
+
+	claims, err := s.authService.ValidateAccessToken(ctx, token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	return expiresAt.Time, nil
+}
+
+// Subscribe opens an event stream for the user. After a reconnect with the
+// Last-Event-ID, the missed events are returned for replay, or resumed is false
+// when they are no longer kept and the client must reload its state.
+func (s *StreamService) Subscribe(ctx context.Context, userID int, lastEventID string) (sub *eventbus.Subscription, replay []eventbus.Event, resumed bool, err error) {
+	_, span := tracer.Start(ctx, "StreamService.Subscribe")
+	defer span.End()
+
+	if s.bus.Connections(userID) >= s.cfg.Stream.MaxConnections {
+		return nil, nil, false, ErrTooManyStreams
+	}
+
+	var lastID uint64
+	if lastEventID != "" {
+		if lastID, err = strconv.ParseUint(lastEventID, 10, 64); err != nil || lastID == 0 {
+			lastID = 1 // Unknown ID, always too old to resume from
+		}
+	}
+	sub, replay, resumed = s.bus.Subscribe(userID, lastID)
+	return sub, replay, resumed, nil
+}
+
+func (s *StreamService) Unsubscribe(sub *eventbus.Subscription) {
+	s.bus.Unsubscribe(sub)
+}
+
+// HeartbeatInterval is how often an idle stream sends a comment to keep the
+// connection open through proxies.
+func (s *StreamService) HeartbeatInterval() time.Duration {
+	return s.cfg.Stream.HeartbeatInterval
+}
+
+// SessionCheckInterval is how often an open stream checks its session is
+// still active.
+func (s *StreamService) SessionCheckInterval() time.Duration {
+	return s.cfg.Stream.SessionCheckInterval
+}
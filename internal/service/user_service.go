@@ -1,45 +1,105 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"x-clone/internal/model"
 	"x-clone/internal/repository"
+	"x-clone/pkg/eventbus"
+	"x-clone/pkg/metrics"
 	"x-clone/pkg/utils/hash"
+
+	"gorm.io/gorm"
 )
 
 type UserService struct {
 	userRepo *repository.UserRepository
+	events   publisher
 }
 
-func NewUserService(userRepo *repository.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(userRepo *repository.UserRepository, bus *eventbus.Bus) *UserService {
+	return &UserService{userRepo: userRepo, events: publisher{bus: bus, userRepo: userRepo}}
 }
 
-func (s *UserService) GetUserByUsername(username string) (*model.UserResponse, error) {
-	user, err := s.userRepo.FindUserByUsername(username)
+func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*model.UserResponse, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetUserByUsername")
+	defer span.End()
+
+	user, err := s.userRepo.FindUserByUsername(ctx, username)
 	if err != nil {
-		return nil, errors.New("user not found")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if !user.Visible() {
+		return nil, ErrUserNotFound
 	}
 	userResponse := user.ToResponse()
 	return &userResponse, nil
 }
 
-func (s *UserService) FollowUser(followerID, followingID int) error {
+func (s *UserService) FollowUser(ctx context.Context, followerID, followingID int) error {
+	ctx, span := tracer.Start(ctx, "UserService.FollowUser")
+	defer span.End()
+
 	if followerID == followingID {
-		return errors.New("you cannot follow yourself")
+		return ErrSelfFollow
+	}
+	if err := requireVerifiedEmail(ctx, s.userRepo, followerID); err != nil {
+		return err
+	}
+	blocked, err := s.userRepo.IsBlocked(ctx, followerID, followingID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserBlocked
+	}
+	followed, err := s.userRepo.FollowUser(ctx, followerID, followingID)
+	if err != nil {
+		return err
+	}
+	if followed {
+		metrics.FollowsTotal.Inc()
+		s.events.userFollowed(ctx, followerID, followingID)
 	}
-	return s.userRepo.FollowUser(followerID, followingID)
+	return nil
 }
 
-func (s *UserService) StopFollowingUser(followerID, followingID int) error {
+func (s *UserService) StopFollowingUser(ctx context.Context, followerID, followingID int) error {
+	ctx, span := tracer.Start(ctx, "UserService.StopFollowingUser")
+	defer span.End()
+
 	if followerID == followingID {
-		return errors.New("you cannot stop following yourself")
+		return ErrSelfUnfollow
 	}
-	return s.userRepo.StopFollowingUser(followerID, followingID)
+	return s.userRepo.StopFollowingUser(ctx, followerID, followingID)
+}
+
+// BlockUser also removes follows between the two users in both directions.
+func (s *UserService) BlockUser(ctx context.Context, blockerID, blockedID int) error {
+	ctx, span := tracer.Start(ctx, "UserService.BlockUser")
+	defer span.End()
+
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+	return s.userRepo.BlockUser(ctx, blockerID, blockedID)
+}
+
+func (s *UserService) UnblockUser(ctx context.Context, blockerID, blockedID int) error {
+	ctx, span := tracer.Start(ctx, "UserService.UnblockUser")
+	defer span.End()
+
+	return s.userRepo.UnblockUser(ctx, blockerID, blockedID)
 }
 
-func (s *UserService) GetFollowersByUser(userID int) ([]model.UserResponse, error) {
-	users, err := s.userRepo.GetFollowersByUser(userID)
+func (s *UserService) GetFollowersByUser(ctx context.Context, userID int) ([]model.UserResponse, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetFollowersByUser")
+	defer span.End()
+
+	users, err := s.userRepo.GetFollowersByUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -52,8 +112,11 @@ func (s *UserService) GetFollowersByUser(userID int) ([]model.UserResponse, erro
 	return userResponses, nil
 }
 
-func (s *UserService) GetFollowingByUser(userID int) ([]model.UserResponse, error) {
-	users, err := s.userRepo.GetFollowingByUser(userID)
+func (s *UserService) GetFollowingByUser(ctx context.Context, userID int) ([]model.UserResponse, error) {
+	ctx, span := tracer.Start(ctx, "UserService.GetFollowingByUser")
+	defer span.End()
+
+	users, err := s.userRepo.GetFollowingByUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -66,27 +129,41 @@ func (s *UserService) GetFollowingByUser(userID int) ([]model.UserResponse, erro
 	return userResponses, nil
 }
 
-func (s *UserService) ProfileUpdate(userID int, updates map[string]interface{}) (*model.User, error) {
-	user, err := s.userRepo.ProfileUpdate(userID, updates)
+func (s *UserService) ProfileUpdate(ctx context.Context, userID int, updates map[string]interface{}) (*model.User, error) {
+	ctx, span := tracer.Start(ctx, "UserService.ProfileUpdate")
+	defer span.End()
+
+	user, err := s.userRepo.ProfileUpdate(ctx, userID, updates)
 	if err != nil {
-		return nil, errors.New("failed to update profile")
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUsernameTaken
+		}
+		return nil, err
 	}
 	return user, nil
 }
 
-func (s *UserService) PasswordChange(userID int, oldPassword, newPassword string) error {
-	user, err := s.userRepo.GetUserByID(userID)
+// PasswordChange sets a new password and, with revokeOtherSessions, signs out
+// every session but the current one.
+func (s *UserService) PasswordChange(ctx context.Context, userID int, sessionID, oldPassword, newPassword string, revokeOtherSessions bool) error {
+	ctx, span := tracer.Start(ctx, "UserService.PasswordChange")
+	defer span.End()
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	if !hash.CheckPassword(oldPassword, user.Password) {
-		return errors.New("invalid old_password")
+		return ErrInvalidOldPassword
 	}
 	hashedNewPassword, err := hash.HashPassword(newPassword)
 	if err != nil {
 		return err
 	}
 
-	return s.userRepo.PasswordChange(user.UserID, hashedNewPassword)
+	if revokeOtherSessions {
+		return s.userRepo.PasswordChangeSignOut(ctx, user.UserID, hashedNewPassword, sessionID)
+	}
+	return s.userRepo.PasswordChange(ctx, user.UserID, hashedNewPassword)
 }
@@ -0,0 +1,466 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/metrics"
+	"x-clone/pkg/webhook"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// EventPing is delivered on request to test a webhook.
+const EventPing = "ping"
+
+// webhookSecretPrefix tells webhook secrets apart from other tokens.
+const webhookSecretPrefix = "whsec_"
+
+// webhookPayload is the body of a delivery.
+type webhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type WebhookService struct {
+	webhookRepo *repository.WebhookRepository
+	userRepo    *repository.UserRepository
+	postRepo    *repository.PostRepository
+	jobs        *JobService
+	client      *http.Client
+	cfg         *config.Config
+}
+
+func NewWebhookService(webhookRepo *repository.WebhookRepository, userRepo *repository.UserRepository, postRepo *repository.PostRepository, jobs *JobService, cfg *config.Config) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		userRepo:    userRepo,
+		postRepo:    postRepo,
+		jobs:        jobs,
+		client:      webhook.NewClient(cfg.Webhooks.Timeout, cfg.Webhooks.AllowPrivateNetworks),
+		cfg:         cfg,
+	}
+}
+
+// CreateWebhook returns the secret deliveries are signed with, which cannot be
+// shown again.
+func (s *WebhookService) CreateWebhook(ctx context.Context, userID int, url string, events []string) (string, *model.Webhook, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.CreateWebhook")
+	defer span.End()
+
+	if err := requireVerifiedEmail(ctx, s.userRepo, userID); err != nil {
+		return "", nil, err
+	}
+	secret, _, err := generateSecretToken()
+	if err != nil {
+		return "", nil, err
+	}
+	hook := &model.Webhook{
+		UserID: userID,
+		URL:    url,
+		Secret: webhookSecretPrefix + secret,
+		Events: events,
+	}
+	created, err := s.webhookRepo.CreateWebhook(ctx, hook, s.cfg.Webhooks.MaxPerUser)
+	if err != nil {
+		return "", nil, err
+	}
+	if !created {
+		return "", nil, ErrTooManyWebhooks
+	}
+	return hook.Secret, hook, nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context, userID int) ([]model.Webhook, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.GetWebhooks")
+	defer span.End()
+
+	return s.webhookRepo.GetWebhooks(ctx, userID)
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, userID, webhookID int) (*model.Webhook, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.GetWebhook")
+	defer span.End()
+
+	hook, err := s.webhookRepo.GetWebhook(ctx, userID, webhookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return hook, nil
+}
+
+// UpdateWebhook changes the URL or events. Disabling a webhook gives up on its
+// pending deliveries, enabling it starts over with a clean failure count.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, userID, webhookID int, url *string, events []string, active *bool) (*model.Webhook, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.UpdateWebhook")
+	defer span.End()
+
+	hook, err := s.GetWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if url != nil {
+		hook.URL = *url
+		updates["url"] = hook.URL
+	}
+	if events != nil {
+		hook.Events = events
+		updates["events"] = hook.Events
+	}
+	if active != nil && *active != (hook.DisabledAt == nil) {
+		if *active {
+			hook.DisabledAt = nil
+			hook.ConsecutiveFailures = 0
+			updates["consecutive_failures"] = 0
+		} else {
+			now := time.Now()
+			hook.DisabledAt = &now
+		}
+		updates["disabled_at"] = hook.DisabledAt
+	}
+	if len(updates) == 0 {
+		return hook, nil
+	}
+
+	if err := s.webhookRepo.UpdateWebhook(ctx, hook, updates); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID, webhookID int) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.DeleteWebhook")
+	defer span.End()
+
+	if err := s.webhookRepo.DeleteWebhook(ctx, userID, webhookID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrWebhookNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// PingWebhook queues a ping delivery, also to disabled webhooks so an
+// endpoint can be checked before enabling it again.
+func (s *WebhookService) PingWebhook(ctx context.Context, userID, webhookID int) (*model.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.PingWebhook")
+	defer span.End()
+
+	hook, err := s.GetWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := s.enqueue(ctx, []model.Webhook{*hook}, EventPing, nil, struct {
+		WebhookID int `json:"webhook_id"`
+	}{hook.WebhookID})
+	if err != nil {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+// GetDeliveries returns a page of the webhook's deliveries with their attempts, newest first.
+func (s *WebhookService) GetDeliveries(ctx context.Context, userID, webhookID int, cursor string, limit int) ([]model.WebhookDelivery, string, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.GetDeliveries")
+	defer span.End()
+
+	_, beforeID, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := s.GetWebhook(ctx, userID, webhookID); err != nil {
+		return nil, "", err
+	}
+	deliveries, err := s.webhookRepo.GetDeliveries(ctx, webhookID, beforeID, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(deliveries) == limit {
+		last := deliveries[len(deliveries)-1]
+		next = encodeCursor(last.CreatedAt, last.WebhookDeliveryID)
+	}
+	return deliveries, next, nil
+}
+
+// Subscribe has the relay hand it the domain events webhooks are notified of.
+func (s *WebhookService) Subscribe(outbox *OutboxService) {
+	outbox.Subscribe("webhooks", s.handleDomainEvent, model.EventPostCreated, model.EventPostLiked, model.EventPostReposted, model.EventUserFollowed)
+}
+
+// handleDomainEvent queues deliveries of the account events a domain event
+// amounts to. Deliveries are unique per webhook and domain event, so handling
+// an event again queues nothing new.
+func (s *WebhookService) handleDomainEvent(ctx context.Context, event *model.OutboxEvent, data model.DomainEvent) error {
+	switch data := data.(type) {
+	case *model.PostCreated:
+		if data.Imported {
+			return nil
+		}
+		post, err := s.postRepo.GetUserPostByID(ctx, data.UserID, data.PostID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil // Deleted since
+			}
+			return err
+		}
+		postData := func(username string) interface{} {
+			return postEvent{Username: username, Post: post}
+		}
+		if err := s.notify(ctx, event, data.UserID, data.UserID, EventPostCreated, postData); err != nil {
+			return err
+		}
+		if post.OriginalPost != nil && post.OriginalPost.UserID != data.UserID {
+			return s.notify(ctx, event, post.OriginalPost.UserID, data.UserID, EventPostQuoted, postData)
+		}
+	case *model.PostLiked:
+		return s.notifyInteraction(ctx, event, model.PostInteraction(*data), EventPostLiked)
+	case *model.PostReposted:
+		return s.notifyInteraction(ctx, event, model.PostInteraction(*data), EventPostReposted)
+	case *model.UserFollowed:
+		return s.notify(ctx, event, data.FollowingID, data.FollowerID, EventUserFollowed, func(username string) interface{} {
+			return followEvent{Username: username}
+		})
+	}
+	return nil
+}
+
+// notifyInteraction tells the author about someone else's like or repost.
+func (s *WebhookService) notifyInteraction(ctx context.Context, event *model.OutboxEvent, interaction model.PostInteraction, eventType string) error {
+	if interaction.AuthorID == interaction.UserID {
+		return nil
+	}
+	return s.notify(ctx, event, interaction.AuthorID, interaction.UserID, eventType, func(username string) interface{} {
+		return interactionEvent{Username: username, PostID: interaction.PostID}
+	})
+}
+
+// notify queues the event about actorID's action for the webhooks of owner
+// subscribed to it. data is built with the actor's username only if there are any.
+func (s *WebhookService) notify(ctx context.Context, event *model.OutboxEvent, owner, actorID int, eventType string, data func(username string) interface{}) error {
+	webhooks, err := s.subscribed(ctx, owner, eventType)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	actor, err := s.userRepo.GetUserByID(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted since
+		}
+		return err
+	}
+	_, err = s.enqueue(ctx, webhooks, eventType, event, data(actor.Username))
+	return err
+}
+
+// subscribed returns the user's active webhooks subscribed to the event.
+func (s *WebhookService) subscribed(ctx context.Context, userID int, event string) ([]model.Webhook, error) {
+	webhooks, err := s.webhookRepo.GetActiveWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(webhooks, func(hook model.Webhook) bool {
+		return !slices.Contains(hook.Events, event)
+	}), nil
+}
+
+// enqueue queues a delivery of the event to each webhook, each sent by a job.
+// source is the domain event it comes from, nil for pings.
+func (s *WebhookService) enqueue(ctx context.Context, webhooks []model.Webhook, event string, source *model.OutboxEvent, data interface{}) ([]model.WebhookDelivery, error) {
+	createdAt := time.Now()
+	var sourceID *int64
+	if source != nil {
+		createdAt = source.CreatedAt
+		sourceID = &source.OutboxEventID
+	}
+	payload, err := json.Marshal(webhookPayload{Event: event, CreatedAt: createdAt, Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]model.WebhookDelivery, 0, len(webhooks))
+	for _, hook := range webhooks {
+		deliveries = append(deliveries, model.WebhookDelivery{
+			WebhookID:     hook.WebhookID,
+			OutboxEventID: sourceID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	if err := s.webhookRepo.CreateDeliveries(ctx, deliveries); err != nil {
+		return nil, err
+	}
+
+	for i, delivery := range deliveries {
+		if delivery.WebhookDeliveryID == 0 {
+			continue // Queued when the domain event was handled before
+		}
+		if _, err := s.jobs.Enqueue(ctx, DeliverWebhookJob{DeliveryID: delivery.WebhookDeliveryID}); err != nil {
+			// The deliveries left without a job are queued again when the domain event is retried
+			var unqueued []int
+			for _, delivery := range deliveries[i:] {
+				if delivery.WebhookDeliveryID != 0 {
+					unqueued = append(unqueued, delivery.WebhookDeliveryID)
+				}
+			}
+			if err := s.webhookRepo.DeleteDeliveries(ctx, unqueued); err != nil {
+				logging.FromContext(ctx).WithError(err).Error("failed to delete webhook deliveries")
+			}
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+// DeliverWebhookJob sends a queued delivery, every attempt is a job of its own.
+type DeliverWebhookJob struct {
+	DeliveryID int `json:"delivery_id"`
+}
+
+func (DeliverWebhookJob) JobType() string { return "webhooks.deliver" }
+
+// CleanupWebhooksJob removes completed deliveries past their retention.
+type CleanupWebhooksJob struct{}
+
+func (CleanupWebhooksJob) JobType() string { return "webhooks.cleanup" }
+
+func (s *WebhookService) RegisterJobs(jobs *JobService) {
+	RegisterJob(jobs, QueueWebhooks, s.deliverJob)
+	RegisterJob(jobs, QueueMaintenance, s.cleanup)
+}
+
+func (s *WebhookService) cleanup(ctx context.Context, _ CleanupWebhooksJob) error {
+	return s.webhookRepo.DeleteCompletedDeliveries(ctx, time.Now().Add(-s.cfg.Webhooks.Retention))
+}
+
+// deliverJob makes an attempt at the delivery and schedules the next one if
+// it failed.
+func (s *WebhookService) deliverJob(ctx context.Context, job DeliverWebhookJob) error {
+	delivery, err := s.webhookRepo.GetDelivery(ctx, job.DeliveryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Deleted with its webhook
+		}
+		return err
+	}
+	if delivery.Status != model.DeliveryPending {
+		return nil // Given up with a disabled webhook
+	}
+	webhooks, err := s.webhookRepo.GetWebhooksByIDs(ctx, []int{delivery.WebhookID})
+	if err != nil {
+		return err
+	}
+
+	if err := s.deliver(ctx, webhooks[delivery.WebhookID], delivery); err != nil {
+		return err
+	}
+	if delivery.Status == model.DeliveryPending {
+		_, err := s.jobs.Schedule(ctx, job, delivery.NextAttemptAt)
+		return err
+	}
+	return nil
+}
+
+// deliver attempts the delivery once and sets the time of the next attempt on
+// failure.
+func (s *WebhookService) deliver(ctx context.Context, hook *model.Webhook, delivery *model.WebhookDelivery) error {
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{"webhook_id": delivery.WebhookID, "delivery_id": delivery.WebhookDeliveryID, "event": delivery.Event})
+
+	if hook == nil || hook.DisabledAt != nil && delivery.Event != EventPing {
+		delivery.Status = model.DeliveryFailed
+		return s.webhookRepo.FailDelivery(ctx, delivery.WebhookDeliveryID)
+	}
+
+	attempt := s.send(ctx, hook, delivery)
+	delivery.Attempts++
+	result := metrics.DeliverySucceeded
+	switch {
+	case attempt.Error == "":
+		now := time.Now()
+		delivery.Status = model.DeliverySucceeded
+		delivery.CompletedAt = &now
+	case delivery.Attempts >= s.cfg.Webhooks.MaxAttempts || delivery.Event == EventPing:
+		now := time.Now()
+		delivery.Status = model.DeliveryFailed
+		delivery.CompletedAt = &now
+		result = metrics.DeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(backoff(s.cfg.Webhooks.BaseBackoff, s.cfg.Webhooks.MaxBackoff, delivery.Attempts))
+		result = metrics.DeliveryRetrying
+	}
+	metrics.WebhookDeliveriesTotal.WithLabelValues(result).Inc()
+
+	// Pings test the endpoint and do not count against it
+	disableAfter := s.cfg.Webhooks.DisableAfter
+	if delivery.Event == EventPing {
+		disableAfter = 0
+	}
+	disabled, err := s.webhookRepo.SaveAttempt(ctx, delivery, attempt, disableAfter)
+	if err != nil {
+		return err
+	}
+	if attempt.Error != "" {
+		entry.WithFields(logrus.Fields{"attempt": delivery.Attempts, "error": attempt.Error}).Warn("webhook delivery failed")
+	}
+	if disabled {
+		entry.Warn("webhook disabled after repeated failures")
+	}
+	return nil
+}
+
+// send posts the signed payload, any response but a 2xx is a failure.
+func (s *WebhookService) send(ctx context.Context, hook *model.Webhook, delivery *model.WebhookDelivery) *model.WebhookAttempt {
+	attempt := &model.WebhookAttempt{AttemptedAt: time.Now()}
+	defer func() {
+		attempt.DurationMS = time.Since(attempt.AttemptedAt).Milliseconds()
+	}()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = truncate(err.Error(), 256)
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "x-clone-webhooks/1.0")
+	req.Header.Set(webhook.HeaderEvent, delivery.Event)
+	req.Header.Set(webhook.HeaderDelivery, strconv.Itoa(delivery.WebhookDeliveryID))
+	req.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(attempt.AttemptedAt.Unix(), 10))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(hook.Secret, attempt.AttemptedAt, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		attempt.Error = truncate(err.Error(), 256)
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Lets the connection be reused
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
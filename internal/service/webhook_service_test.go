@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/internal/model"
+	"x-clone/internal/repository"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/webhook"
+
+	"github.com/glebarez/sqlite"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestWebhookService(t *testing.T) (*WebhookService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // Every connection would open its own in-memory database
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&model.Webhook{}, &model.WebhookDelivery{}, &model.WebhookAttempt{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Webhooks: config.WebhooksConfig{
+		Timeout:              5 * time.Second,
+		MaxAttempts:          1,
+		BaseBackoff:          time.Second,
+		MaxBackoff:           time.Minute,
+		DisableAfter:         2,
+		AllowPrivateNetworks: true, // The receiver listens on loopback
+	}}
+	return NewWebhookService(repository.NewWebhookRepository(db), nil, nil, nil, cfg), db
+}
+
+// testContext carries a logger discarding the delivery logs.
+func testContext() context.Context {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return logging.WithEntry(context.Background(), logrus.NewEntry(log))
+}
+
+func createTestDelivery(t *testing.T, db *gorm.DB, hook *model.Webhook, status string) *model.WebhookDelivery {
+	t.Helper()
+	delivery := &model.WebhookDelivery{
+		WebhookID:     hook.WebhookID,
+		Event:         EventPostCreated,
+		Payload:       `{"event":"post.created","data":{"post_id":1}}`,
+		Status:        status,
+		NextAttemptAt: time.Now(),
+	}
+	if err := db.Create(delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func TestDeliverSignsRequests(t *testing.T) {
+	s, db := newTestWebhookService(t)
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{UserID: 1, URL: srv.URL, Secret: "whsec_test", Events: []string{EventPostCreated}}
+	if err := db.Create(hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	delivery := createTestDelivery(t, db, hook, model.DeliveryPending)
+
+	if err := s.deliver(testContext(), hook, delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	if string(req.body) != delivery.Payload {
+		t.Errorf("body = %s, want %s", req.body, delivery.Payload)
+	}
+	if got := req.header.Get(webhook.HeaderEvent); got != EventPostCreated {
+		t.Errorf("%s = %q, want %q", webhook.HeaderEvent, got, EventPostCreated)
+	}
+	if got := req.header.Get(webhook.HeaderDelivery); got != strconv.Itoa(delivery.WebhookDeliveryID) {
+		t.Errorf("%s = %q, want %d", webhook.HeaderDelivery, got, delivery.WebhookDeliveryID)
+	}
+	unix, err := strconv.ParseInt(req.header.Get(webhook.HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("%s: %v", webhook.HeaderTimestamp, err)
+	}
+	if got, want := req.header.Get(webhook.HeaderSignature), webhook.Sign(hook.Secret, time.Unix(unix, 0), req.body); got != want {
+		t.Errorf("%s = %q, want %q", webhook.HeaderSignature, got, want)
+	}
+
+	var saved model.WebhookDelivery
+	if err := db.Preload("AttemptLog").First(&saved, delivery.WebhookDeliveryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != model.DeliverySucceeded || len(saved.AttemptLog) != 1 || saved.AttemptLog[0].StatusCode != http.StatusNoContent {
+		t.Errorf("delivery = %s with attempts %+v, want succeeded with one 204 attempt", saved.Status, saved.AttemptLog)
+	}
+}
+
+func TestDeliverDisablesFailingWebhook(t *testing.T) {
+	s, db := newTestWebhookService(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{UserID: 1, URL: srv.URL, Secret: "whsec_test", Events: []string{EventPostCreated}}
+	if err := db.Create(hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	queued := createTestDelivery(t, db, hook, model.DeliveryPending)
+
+	for i := 1; i <= s.cfg.Webhooks.DisableAfter; i++ {
+		if err := s.deliver(testContext(), hook, createTestDelivery(t, db, hook, model.DeliveryPending)); err != nil {
+			t.Fatal(err)
+		}
+
+		var saved model.Webhook
+		if err := db.First(&saved, hook.WebhookID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if saved.ConsecutiveFailures != i {
+			t.Errorf("after %d failed deliveries, consecutive_failures = %d", i, saved.ConsecutiveFailures)
+		}
+		if disabled := saved.DisabledAt != nil; disabled != (i == s.cfg.Webhooks.DisableAfter) {
+			t.Errorf("after %d failed deliveries, disabled = %v", i, disabled)
+		}
+	}
+
+	// Deliveries still queued are given up with the webhook
+	if err := db.First(queued, queued.WebhookDeliveryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if queued.Status != model.DeliveryFailed {
+		t.Errorf("queued delivery = %s, want %s", queued.Status, model.DeliveryFailed)
+	}
+}
+
+func TestDeliverJobSchedulesRetry(t *testing.T) {
+	s, db := newTestWebhookService(t)
+	if err := db.AutoMigrate(&model.Job{}); err != nil {
+		t.Fatal(err)
+	}
+	s.jobs = NewJobService(repository.NewJobRepository(db), s.cfg)
+	s.RegisterJobs(s.jobs)
+	s.cfg.Webhooks.MaxAttempts = 2
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	hook := &model.Webhook{UserID: 1, URL: srv.URL, Secret: "whsec_test", Events: []string{EventPostCreated}}
+	if err := db.Create(hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := s.enqueue(testContext(), []model.Webhook{*hook}, EventPostCreated, nil, struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := DeliverWebhookJob{DeliveryID: deliveries[0].WebhookDeliveryID}
+
+	var jobs []model.Job
+	if err := db.Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Type != job.JobType() || jobs[0].Queue != QueueWebhooks {
+		t.Fatalf("queued jobs = %+v, want one %s job", jobs, job.JobType())
+	}
+
+	// The failed first attempt schedules the second at the delivery's next attempt
+	if err := s.deliverJob(testContext(), job); err != nil {
+		t.Fatal(err)
+	}
+	var delivery model.WebhookDelivery
+	if err := db.First(&delivery, job.DeliveryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Order("job_id").Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliveryPending || len(jobs) != 2 || !jobs[1].RunAt.Equal(delivery.NextAttemptAt) {
+		t.Fatalf("after one failed attempt, delivery = %s and jobs = %+v, want pending with a job at %s", delivery.Status, jobs, delivery.NextAttemptAt)
+	}
+
+	// The last attempt gives up without scheduling another
+	if err := s.deliverJob(testContext(), job); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&delivery, job.DeliveryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := db.Model(&model.Job{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliveryFailed || count != 2 {
+		t.Errorf("after the last attempt, delivery = %s with %d jobs, want failed with 2 jobs", delivery.Status, count)
+	}
+}
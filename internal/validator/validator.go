@@ -1,17 +1,122 @@
 package validator
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New()
+var validate = newValidate()
+
+func newValidate() *validator.Validate {
+	v := validator.New()
+
+	// Report fields by their JSON name instead of the Go struct field name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("not_reserved", func(fl validator.FieldLevel) bool {
+		return !reservedUsernames[strings.ToLower(fl.Field().String())]
+	})
+
+	return v
+}
+
+// Top-level paths of the router, whose profile routes /{username} would shadow
+var reservedUsernames = map[string]bool{
+	".well-known":   true,
+	"auth":          true,
+	"compose":       true,
+	"conversations": true,
+	"gateway":       true,
+	"settings":      true,
+	"stream":        true,
+}
 
 func Validate(s interface{}) error {
 	return validate.Struct(s)
 }
 
+// FieldErrors converts a validation error into messages keyed by JSON field name.
+func FieldErrors(err error) map[string]string {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	fields := make(map[string]string, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields[fe.Field()] = fieldMessage(fe)
+	}
+	return fields
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit(fe.Kind()))
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit(fe.Kind()))
+	case "unique":
+		return "must not contain duplicates"
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(fe.Param()), ", "))
+	case "email":
+		return "must be a valid email address"
+	case "http_url":
+		return "must be a valid http or https url"
+	case "datetime":
+		return fmt.Sprintf("must match the format %s", fe.Param())
+	case "eqfield":
+		return fmt.Sprintf("must be equal to %s", toSnakeCase(fe.Param()))
+	case "nefield":
+		return fmt.Sprintf("must not be equal to %s", toSnakeCase(fe.Param()))
+	case "not_reserved":
+		return "is reserved"
+	default:
+		return fmt.Sprintf("failed the %s check", fe.Tag())
+	}
+}
+
+func unit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Map:
+		return " items"
+	default:
+		return ""
+	}
+}
+
+// Params of eqfield/nefield are Go field names, our JSON names are their snake_case
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 type RegisterRequest struct {
-	Username  string  `json:"username" validate:"required,min=6,max=20"`
+	Username  string  `json:"username" validate:"required,min=6,max=20,not_reserved"`
+	Email     string  `json:"email" validate:"required,email,max=254"`
 	Password  string  `json:"password" validate:"required,min=7,max=32"`
 	FirstName string  `json:"first_name" validate:"required,min=2,max=32"`
 	LastName  string  `json:"last_name" validate:"required,min=2,max=32"`
@@ -25,19 +130,92 @@ type LoginRequest struct {
 }
 
 type ProfileUpdateRequest struct {
-	Username  *string `json:"username" validate:"omitempty,min=6,max=20"`
+	Username  *string `json:"username" validate:"omitempty,min=6,max=20,not_reserved"`
 	FirstName *string `json:"first_name" validate:"omitempty,min=2,max=32"`
 	LastName  *string `json:"last_name" validate:"omitempty,min=2,max=32"`
 	Birthday  *string `json:"birthday" validate:"omitempty,datetime=2006-01-02"`
 	Bio       *string `json:"bio" validate:"omitempty,min=1,max=300"`
+
+	DMPermission *string `json:"dm_permission" validate:"omitempty,oneof=everyone following"`
 }
 
 type PasswordChangeRequest struct {
-	OldPassword     string `json:"old_password" validate:"required,min=7,max=32"`
-	NewPassword     string `json:"new_password" validate:"required,min=7,max=32,nefield=OldPassword"`
-	ConfirmPassword string `json:"confirm_password" validate:"required,min=7,max=32,eqfield=NewPassword"`
+	OldPassword         string `json:"old_password" validate:"required,min=7,max=32"`
+	NewPassword         string `json:"new_password" validate:"required,min=7,max=32,nefield=OldPassword"`
+	ConfirmPassword     string `json:"confirm_password" validate:"required,min=7,max=32,eqfield=NewPassword"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
 }
 
 type ContentRequest struct {
 	Content string `json:"content" validate:"required,min=1,max=1000"`
 }
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,min=6,max=32"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,min=6,max=32"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=7,max=32"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,min=7,max=32,eqfield=NewPassword"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type EmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type PersonalAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,min=1,max=64"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=users:read posts:read posts:write follows:write"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,unique,dive,oneof=post.created post.liked post.reposted post.quoted user.followed"`
+}
+
+type WebhookUpdateRequest struct {
+	URL    *string  `json:"url" validate:"omitempty,http_url,max=2048"`
+	Events []string `json:"events" validate:"omitempty,min=1,unique,dive,oneof=post.created post.liked post.reposted post.quoted user.followed"`
+	Active *bool    `json:"active"`
+}
+
+type DirectMessageRequest struct {
+	Username string `json:"username" validate:"required,min=6,max=20"`
+	Content  string `json:"content" validate:"required,min=1,max=1000"`
+}
+
+type GroupCreateRequest struct {
+	Name      *string  `json:"name" validate:"omitempty,min=1,max=64"`
+	Usernames []string `json:"usernames" validate:"required,min=1,unique,dive,min=6,max=20"`
+}
+
+type ParticipantsRequest struct {
+	Usernames []string `json:"usernames" validate:"required,min=1,unique,dive,min=6,max=20"`
+}
+
+type ParticipantRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type ConversationRenameRequest struct {
+	Name *string `json:"name" validate:"omitempty,min=1,max=64"` // null clears the name
+}
+
+type PasswordConfirmRequest struct {
+	Password string `json:"password" validate:"required,min=7,max=32"`
+}
@@ -8,6 +8,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 func ConnectDB(cfg *config.Config) (*gorm.DB, error) {
@@ -19,17 +20,45 @@ func ConnectDB(cfg *config.Config) (*gorm.DB, error) {
 		cfg.Database.Password,
 		cfg.Database.SSLMode)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		TranslateError: true, // Unique violations as gorm.ErrDuplicatedKey
+	})
 	if err != nil {
 		log.Fatalf("failed to connect to the database")
 	}
 
+	// Span per query, parented by the span in the statement context
+	if err := db.Use(gormtracing.NewPlugin(gormtracing.WithoutMetrics())); err != nil {
+		return nil, err
+	}
+
 	err = db.AutoMigrate(
 		&model.User{},
 		&model.Post{},
 		&model.Follower{},
 		&model.Repost{},
 		&model.Like{},
+		&model.LoginEvent{},
+		&model.LoginThrottle{},
+		&model.TOTP{},
+		&model.RecoveryCode{},
+		&model.PasswordResetToken{},
+		&model.EmailVerificationToken{},
+		&model.Session{},
+		&model.PersonalAccessToken{},
+		&model.DataExport{},
+		&model.DataImport{},
+		&model.ImportFailure{},
+		&model.Block{},
+		&model.Conversation{},
+		&model.ConversationParticipant{},
+		&model.Message{},
+		&model.MessageDeletion{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.WebhookAttempt{},
+		&model.OutboxEvent{},
+		&model.Job{},
 	)
 	if err != nil {
 		log.Fatalf("failed to apply migrations")
@@ -0,0 +1,224 @@
+// Package eventbus fans out events to the live connections of their recipients.
+// Recent events are kept per user so a client that reconnects can resume where
+// it left off.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+	"x-clone/internal/config"
+	"x-clone/pkg/metrics"
+)
+
+type Event struct {
+	ID   uint64
+	Type string
+	Data json.RawMessage
+	At   time.Time
+}
+
+// Subscription is one connection of a user. C is closed when the subscriber
+// falls behind, the bus is closed or Unsubscribe is called.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID int
+	closed bool
+	lagged bool
+}
+
+// Lagged reports whether C was closed because the subscriber was too slow.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// recipient is the state of a user that is connected or was recently.
+type recipient struct {
+	subs     map[*Subscription]struct{}
+	replay   []Event
+	floor    uint64 // Events up to this ID are not in replay anymore
+	lastSeen time.Time
+}
+
+type Bus struct {
+	cfg config.StreamConfig
+
+	mu         sync.Mutex
+	seq        uint64
+	recipients map[int]*recipient
+	closed     bool
+}
+
+func New(cfg *config.Config) *Bus {
+	// IDs keep growing across restarts so IDs from a previous process are
+	// detected as too old to resume from
+	return &Bus{
+		cfg:        cfg.Stream,
+		seq:        uint64(time.Now().UnixMicro()),
+		recipients: make(map[int]*recipient),
+	}
+}
+
+// Active reports whether events for the user would be delivered or kept, so
+// publishers can skip building events nobody receives.
+func (b *Bus) Active(userID int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.recipients[userID]
+	return ok
+}
+
+// Idle reports whether no user is connected or recently was.
+func (b *Bus) Idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.recipients) == 0
+}
+
+// Publish sends the event to the connected and recently connected recipients.
+// It never blocks, subscribers that cannot keep up are disconnected.
+func (b *Bus) Publish(eventType string, data interface{}, userIDs ...int) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		r, ok := b.recipients[userID]
+		if !ok {
+			continue
+		}
+
+		b.seq++
+		event := Event{ID: b.seq, Type: eventType, Data: raw, At: now}
+		r.replay = append(r.replay, event)
+		if len(r.replay) > b.cfg.ReplaySize {
+			r.floor = r.replay[0].ID
+			r.replay = r.replay[1:]
+		}
+
+		for sub := range r.subs {
+			select {
+			case sub.ch <- event:
+			default:
+				sub.lagged = true
+				b.remove(r, sub)
+				metrics.StreamLaggedTotal.Inc()
+			}
+		}
+		metrics.StreamEventsTotal.WithLabelValues(eventType).Inc()
+	}
+	return nil
+}
+
+// Subscribe connects the user. With a lastEventID, the events after it are
+// returned for replay, or ok is false when some of them are no longer kept.
+func (b *Bus) Subscribe(userID int, lastEventID uint64) (sub *Subscription, replay []Event, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	r, exists := b.recipients[userID]
+	if !exists {
+		r = &recipient{subs: make(map[*Subscription]struct{}), floor: b.seq}
+		b.recipients[userID] = r
+	}
+	r.lastSeen = time.Now()
+
+	ch := make(chan Event, b.cfg.SubscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, userID: userID}
+	if b.closed {
+		sub.closed = true
+		close(ch)
+		return sub, nil, true
+	}
+	r.subs[sub] = struct{}{}
+	metrics.StreamSubscribers.Inc()
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+	if lastEventID < r.floor || lastEventID > b.seq {
+		return sub, nil, false
+	}
+	for _, event := range r.replay {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, true
+}
+
+// Connections counts the user's open subscriptions.
+func (b *Bus) Connections(userID int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.recipients[userID]; ok {
+		return len(r.subs)
+	}
+	return 0
+}
+
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.recipients[sub.userID]; ok {
+		b.remove(r, sub)
+	}
+}
+
+func (b *Bus) remove(r *recipient, sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	delete(r.subs, sub)
+	r.lastSeen = time.Now()
+	metrics.StreamSubscribers.Dec()
+}
+
+// Close disconnects every subscriber, for the server to shut down.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, r := range b.recipients {
+		for sub := range r.subs {
+			b.remove(r, sub)
+		}
+	}
+}
+
+// Run forgets users that have been disconnected longer than the replay window
+// until ctx is done.
+func (b *Bus) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.ReplayWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.prune(time.Now().Add(-b.cfg.ReplayWindow))
+		}
+	}
+}
+
+func (b *Bus) prune(before time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for userID, r := range b.recipients {
+		if len(r.subs) == 0 && r.lastSeen.Before(before) {
+			delete(b.recipients, userID)
+		}
+	}
+}
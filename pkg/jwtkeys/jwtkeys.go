@@ -0,0 +1,220 @@
+package jwtkeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"x-clone/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	AlgorithmHS256 = "HS256" // Shared JWT_SECRET, no JWKS
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	// JWKSMaxAge is how long verifiers may cache the key set. New keys are
+	// published twice as long before they start signing.
+	JWKSMaxAge = 5 * time.Minute
+
+	refreshInterval   = time.Minute
+	minReloadInterval = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Manager signs and verifies JWTs with a single algorithm. Asymmetric keys
+// are stored in the database, shared by all instances and rotated every
+// rotation_interval; retired keys keep verifying for rotation_overlap.
+type Manager struct {
+	method   jwt.SigningMethod
+	secret   []byte
+	store    *store
+	interval time.Duration
+	overlap  time.Duration
+
+	mu       sync.RWMutex
+	keys     []*key // Newest first
+	loadedAt time.Time
+}
+
+func New(ctx context.Context, cfg *config.Config, db *gorm.DB) (*Manager, error) {
+	switch cfg.JWT.Algorithm {
+	case AlgorithmHS256, "":
+		if cfg.JWT.Secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		return &Manager{method: jwt.SigningMethodHS256, secret: []byte(cfg.JWT.Secret)}, nil
+	case AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", cfg.JWT.Algorithm)
+	}
+	if cfg.JWT.RotationInterval <= 0 {
+		return nil, errors.New("jwt rotation_interval must be positive")
+	}
+
+	store, err := newStore(db)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{
+		method:   jwt.GetSigningMethod(cfg.JWT.Algorithm),
+		store:    store,
+		interval: cfg.JWT.RotationInterval,
+		// Tokens signed just before a rotation must outlive their key's retirement
+		overlap: max(cfg.JWT.RotationOverlap, cfg.JWT.AccessTokenTTL, cfg.MFA.ChallengeTTL),
+	}
+	if err := m.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manager) Algorithm() string {
+	return m.method.Alg()
+}
+
+// Run rotates and reloads keys until ctx is done.
+func (m *Manager) Run(ctx context.Context, log *logrus.Logger) {
+	if m.store == nil {
+		return
+	}
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.refresh(ctx); err != nil {
+				log.WithError(err).Error("failed to refresh jwt signing keys")
+			}
+		}
+	}
+}
+
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	if m.store == nil {
+		return jwt.NewWithClaims(m.method, claims).SignedString(m.secret)
+	}
+
+	k, err := m.signingKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(m.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+// Parse verifies the signature with the configured algorithm only, so tokens
+// using "none", HS256 with a public key or any other algorithm are rejected.
+func (m *Manager) Parse(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if m.store == nil {
+			return m.secret, nil
+		}
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		k, err := m.verificationKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return k.public, nil
+	}, jwt.WithValidMethods([]string{m.method.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys that currently verify tokens, including
+// retired and not yet active ones.
+func (m *Manager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range m.keys {
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	return set
+}
+
+func (m *Manager) signingKey() (*key, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range m.keys {
+		if !k.activeAt.After(now) && k.expiresAt.After(now) {
+			return k, nil
+		}
+	}
+	return nil, errors.New("no active jwt signing key")
+}
+
+// verificationKey reloads the keys once when kid is unknown, another instance
+// may have rotated since the last refresh.
+func (m *Manager) verificationKey(ctx context.Context, kid string) (*key, error) {
+	if k := m.lookup(kid); k != nil {
+		return k, nil
+	}
+
+	m.mu.RLock()
+	stale := time.Since(m.loadedAt) > minReloadInterval
+	m.mu.RUnlock()
+	if stale {
+		if err := m.load(ctx); err != nil {
+			return nil, err
+		}
+		if k := m.lookup(kid); k != nil {
+			return k, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (m *Manager) lookup(kid string) *key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range m.keys {
+		if k.id == kid && k.expiresAt.After(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+func (m *Manager) refresh(ctx context.Context) error {
+	if err := m.store.rotate(ctx, m.method.Alg(), m.interval, m.overlap); err != nil {
+		return err
+	}
+	return m.load(ctx)
+}
+
+func (m *Manager) load(ctx context.Context) error {
+	keys, err := m.store.load(ctx, m.method.Alg())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
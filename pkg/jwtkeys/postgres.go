@@ -0,0 +1,115 @@
+package jwtkeys
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type keyRow struct {
+	KeyID      string    `gorm:"primaryKey;size:16"`
+	Algorithm  string    `gorm:"size:8;not null;index"`
+	PrivateKey string    `gorm:"not null"` // PKCS#8 PEM
+	ActiveAt   time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (keyRow) TableName() string {
+	return "jwt_signing_keys"
+}
+
+type store struct {
+	db *gorm.DB
+}
+
+func newStore(db *gorm.DB) (*store, error) {
+	if err := db.AutoMigrate(&keyRow{}); err != nil {
+		return nil, err
+	}
+	return &store{db: db}, nil
+}
+
+// rotate publishes the next key ahead of time once the newest one is due to
+// be replaced, and deletes expired keys. The advisory lock keeps concurrent
+// instances from rotating twice.
+func (s *store) rotate(ctx context.Context, algorithm string, interval, overlap time.Duration) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('jwt_signing_keys'))").Error; err != nil {
+			return err
+		}
+
+		// GetNewestKey
+		now := time.Now()
+		activeAt := now
+		var newest keyRow
+		err := tx.Where("algorithm = ? AND expires_at > ?", algorithm, now).Order("active_at DESC").First(&newest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			next := newest.ActiveAt.Add(interval)
+			if now.Before(next.Add(-2 * JWKSMaxAge)) {
+				return tx.Where("expires_at < ?", now).Delete(&keyRow{}).Error
+			}
+			if next.After(now) {
+				activeAt = next
+			}
+		}
+
+		// CreateKey
+		private, err := generateKey(algorithm)
+		if err != nil {
+			return err
+		}
+		encoded, err := encodePrivateKey(private)
+		if err != nil {
+			return err
+		}
+		keyID, err := generateKeyID()
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&keyRow{
+			KeyID:      keyID,
+			Algorithm:  algorithm,
+			PrivateKey: encoded,
+			ActiveAt:   activeAt,
+			ExpiresAt:  activeAt.Add(interval + overlap),
+		}).Error; err != nil {
+			return err
+		}
+
+		// DeleteExpiredKeys
+		return tx.Where("expires_at < ?", now).Delete(&keyRow{}).Error
+	})
+}
+
+func (s *store) load(ctx context.Context, algorithm string) ([]*key, error) {
+	var rows []keyRow
+	if err := s.db.WithContext(ctx).
+		Where("algorithm = ? AND expires_at > ?", algorithm, time.Now()).
+		Order("active_at DESC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]*key, 0, len(rows))
+	for _, row := range rows {
+		private, err := decodePrivateKey(row.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key{
+			id:        row.KeyID,
+			algorithm: row.Algorithm,
+			private:   private,
+			public:    private.Public(),
+			activeAt:  row.ActiveAt,
+			expiresAt: row.ExpiresAt,
+		})
+	}
+	return keys, nil
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+// holder is shared by the whole middleware chain, so fields added deeper
+// (e.g. user_id by AuthMiddleware) are visible to the access log as well.
+type holder struct {
+	mu    sync.RWMutex
+	entry *logrus.Entry
+}
+
+var fallback = logrus.NewEntry(logrus.StandardLogger())
+
+func WithEntry(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, &holder{entry: entry})
+}
+
+func AddFields(ctx context.Context, fields logrus.Fields) {
+	h, ok := ctx.Value(contextKey{}).(*holder)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.entry = h.entry.WithFields(fields)
+	h.mu.Unlock()
+}
+
+// FromContext returns the request-scoped entry with the matched chi route pattern.
+func FromContext(ctx context.Context) *logrus.Entry {
+	h, ok := ctx.Value(contextKey{}).(*holder)
+	if !ok {
+		return fallback.WithContext(ctx)
+	}
+	h.mu.RLock()
+	entry := h.entry
+	h.mu.RUnlock()
+
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			entry = entry.WithField("route", pattern)
+		}
+	}
+	return entry
+}
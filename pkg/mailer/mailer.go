@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"x-clone/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func New(cfg *config.Config, log *logrus.Logger) (Mailer, error) {
+	switch cfg.Mail.Driver {
+	case DriverLog, "":
+		return NewLogMailer(log), nil
+	case DriverFile:
+		return NewFileMailer(cfg.Mail.From, cfg.Mail.FileDir)
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.Mail), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Mail.Driver)
+	}
+}
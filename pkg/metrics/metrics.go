@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "xclone"
+
+// HTTP
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests by route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Business
+var (
+	PostsCreatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Total number of created posts, including quotes.",
+	})
+
+	LikesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "likes_total",
+		Help:      "Total number of new likes.",
+	})
+
+	FollowsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "follows_total",
+		Help:      "Total number of new follows.",
+	})
+
+	LoginsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Total number of login attempts by result.",
+	}, []string{"result"})
+)
+
+// Streaming
+var (
+	StreamSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_subscribers",
+		Help:      "Number of open event stream connections.",
+	})
+
+	StreamEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_events_total",
+		Help:      "Total number of events delivered to recipients by type.",
+	}, []string{"type"})
+
+	StreamLaggedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_lagged_total",
+		Help:      "Total number of event stream connections dropped for falling behind.",
+	})
+
+	GatewayConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "gateway_connections",
+		Help:      "Number of open WebSocket gateway connections.",
+	})
+
+	GatewayEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_events_total",
+		Help:      "Total number of events delivered to WebSocket clients by type.",
+	}, []string{"type"})
+
+	GatewayLaggedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_lagged_total",
+		Help:      "Total number of WebSocket connections dropped for falling behind.",
+	})
+)
+
+// Jobs
+var (
+	JobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_total",
+		Help:      "Total number of job attempts by queue, type and result.",
+	}, []string{"queue", "type", "result"})
+
+	JobDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of job attempts by queue and type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"queue", "type"})
+)
+
+// Outbox
+var (
+	OutboxEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_total",
+		Help:      "Total number of domain event dispatches by type and result.",
+	}, []string{"type", "result"})
+
+	OutboxLagSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "outbox_lag_seconds",
+		Help:      "Time between recording a domain event and dispatching it.",
+		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300},
+	})
+)
+
+// Webhooks
+var WebhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "webhook_deliveries_total",
+	Help:      "Total number of webhook delivery attempts by result.",
+}, []string{"result"})
+
+// Counters
+var CounterDriftsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "counter_drifts_total",
+	Help:      "Total number of denormalized counters found drifted from their rows by counter.",
+}, []string{"counter"})
+
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+	LoginLocked    = "locked"
+)
+
+const (
+	DeliverySucceeded = "succeeded"
+	DeliveryRetrying  = "retrying"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	JobSucceeded = "succeeded"
+	JobRetrying  = "retrying"
+	JobDead      = "dead"
+)
+
+// RegisterDB exposes the connection pool stats of the underlying *sql.DB.
+func RegisterDB(db *gorm.DB, dbName string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return prometheus.Register(collectors.NewDBStatsCollector(sqlDB, dbName))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -2,36 +2,76 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"x-clone/internal/service"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/problem"
+
+	"github.com/sirupsen/logrus"
 )
 
 type ContextKey string
 
 const (
-	UserIDKey ContextKey = "userID"
+	UserIDKey    ContextKey = "userID"
+	SessionIDKey ContextKey = "sessionID"
 )
 
-func AuthMiddleware(authService *service.AuthService) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "you are not authorised", http.StatusUnauthorized)
-				return
-			}
-
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			claims, err := authService.ValidateAccessToken(tokenString)
-			if err != nil {
-				http.Error(w, "invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			userID := int(claims["user_id"].(float64))
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+// AuthMiddleware accepts session access tokens on every route and personal
+// access tokens only on routes with a scope the token was granted.
+func AuthMiddleware(authService *service.AuthService) func(scope string) func(http.Handler) http.Handler {
+	return func(scope string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authHeader := r.Header.Get("Authorization")
+				if authHeader == "" {
+					problem.Error(w, r, http.StatusUnauthorized, "unauthorized", "you are not authorised")
+					return
+				}
+				tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+				// Personal access token
+				if strings.HasPrefix(tokenString, service.PersonalAccessTokenPrefix) {
+					pat, err := authService.ValidatePersonalAccessToken(r.Context(), tokenString)
+					if err != nil {
+						writeAuthError(w, r, err)
+						return
+					}
+					if scope == "" || !pat.HasScope(scope) {
+						problem.Error(w, r, http.StatusForbidden, "insufficient_scope", "token lacks the required scope")
+						return
+					}
+
+					logging.AddFields(r.Context(), logrus.Fields{"user_id": pat.UserID, "token_id": pat.PersonalAccessTokenID})
+					ctx := context.WithValue(r.Context(), UserIDKey, pat.UserID)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+
+				// Session access token
+				claims, err := authService.ValidateAccessToken(r.Context(), tokenString)
+				if err != nil {
+					writeAuthError(w, r, err)
+					return
+				}
+
+				userID := int(claims["user_id"].(float64))
+				logging.AddFields(r.Context(), logrus.Fields{"user_id": userID})
+				ctx := context.WithValue(r.Context(), UserIDKey, userID)
+				ctx = context.WithValue(ctx, SessionIDKey, claims["sid"].(string))
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		}
+	}
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	if !errors.Is(err, service.ErrInvalidToken) {
+		logging.FromContext(r.Context()).WithError(err).Error("failed to validate token")
+		problem.Error(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		return
 	}
+	problem.Error(w, r, http.StatusUnauthorized, "invalid_token", "invalid token")
 }
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/requestid"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func RequestLogger(log *logrus.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			entry := log.WithFields(logrus.Fields{
+				"request_id": requestid.FromContext(r.Context()),
+				"method":     r.Method,
+				"path":       r.URL.Path,
+			})
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+				entry = entry.WithField("trace_id", sc.TraceID().String())
+			}
+			ctx := logging.WithEntry(r.Context(), entry)
+			r = r.WithContext(ctx)
+
+			ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// Access log
+			accessLog := logging.FromContext(ctx).WithFields(logrus.Fields{
+				"status":     status,
+				"bytes":      ww.BytesWritten(),
+				"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+				"client_ip":  GetClientIP(r.Context()),
+				"user_agent": r.UserAgent(),
+			})
+			switch {
+			case status >= http.StatusInternalServerError:
+				accessLog.Error("request completed")
+			case status >= http.StatusBadRequest:
+				accessLog.Warn("request completed")
+			default:
+				accessLog.Info("request completed")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/problem"
+	"x-clone/pkg/ratelimit"
+)
+
+// RateLimiter returns a middleware factory for the named policy. Buckets are
+// keyed by the authenticated user, or by client IP for anonymous requests.
+func RateLimiter(limiter *ratelimit.Limiter) func(policy string) func(http.Handler) http.Handler {
+	return func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			if limiter == nil {
+				return next // Disabled
+			}
+			policy, ok := limiter.Policy(name)
+			if !ok {
+				panic(fmt.Sprintf("rate limit policy %q is not configured", name))
+			}
+
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := "ip:" + GetClientIP(r.Context())
+				if userID, ok := r.Context().Value(UserIDKey).(int); ok {
+					key = "user:" + strconv.Itoa(userID)
+				}
+
+				result, err := limiter.Take(r.Context(), key, policy)
+				if err != nil {
+					// Fail open, an unavailable backend must not take the API down
+					logging.FromContext(r.Context()).WithError(err).Warn("rate limiter unavailable")
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+				w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+				w.Header().Set("RateLimit-Reset", ceilSeconds(result.Reset))
+				w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Requests, int(policy.Period.Seconds())))
+
+				if !result.Allowed {
+					w.Header().Set("Retry-After", ceilSeconds(result.RetryAfter))
+					problem.Error(w, r, http.StatusTooManyRequests, "rate_limited", "too many requests, retry later")
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
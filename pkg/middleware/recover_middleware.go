@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+	"x-clone/pkg/logging"
+	"x-clone/pkg/problem"
+)
+
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec) // Let net/http abort the connection
+			}
+
+			logging.FromContext(r.Context()).
+				WithField("panic", rec).
+				WithField("stack", string(debug.Stack())).
+				Error("recovered from panic")
+
+			problem.Error(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
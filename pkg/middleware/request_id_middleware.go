@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"x-clone/pkg/requestid"
+)
+
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		ctx := requestid.WithContext(r.Context(), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,221 @@
+// Package pubsub delivers events to the connections subscribed to a topic.
+// Unlike the eventbus nothing is kept for replay: a client that reconnects
+// subscribes again and reloads what it shows.
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+	"x-clone/internal/config"
+	"x-clone/pkg/metrics"
+)
+
+// Event is the JSON frame sent to clients.
+type Event struct {
+	Type    string      `json:"type"`
+	Channel string      `json:"channel,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Client is one connection of a user. C receives encoded events and is closed
+// when the client falls behind, the hub is closed or Disconnect is called.
+type Client struct {
+	C      <-chan []byte
+	ch     chan []byte
+	userID int
+	topics map[string]struct{}
+	closed bool
+	lagged bool
+}
+
+// Lagged reports whether C was closed because the client was too slow.
+func (c *Client) Lagged() bool {
+	return c.lagged
+}
+
+type Hub struct {
+	cfg config.GatewayConfig
+
+	mu      sync.Mutex
+	topics  map[string]map[*Client]struct{}
+	clients map[int]map[*Client]struct{} // By user
+	closed  bool
+}
+
+func New(cfg *config.Config) *Hub {
+	return &Hub{
+		cfg:     cfg.Gateway,
+		topics:  make(map[string]map[*Client]struct{}),
+		clients: make(map[int]map[*Client]struct{}),
+	}
+}
+
+func (h *Hub) Connect(userID int) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan []byte, h.cfg.ClientBuffer)
+	c := &Client{C: ch, ch: ch, userID: userID, topics: make(map[string]struct{})}
+	if h.closed {
+		c.closed = true
+		close(ch)
+		return c
+	}
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*Client]struct{})
+	}
+	h.clients[userID][c] = struct{}{}
+	metrics.GatewayConnections.Inc()
+	return c
+}
+
+// Connections counts the user's open connections.
+func (h *Hub) Connections(userID int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID])
+}
+
+func (h *Hub) Disconnect(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnect(c)
+}
+
+func (h *Hub) disconnect(c *Client) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.ch)
+	for topic := range c.topics {
+		h.unsubscribe(c, topic)
+	}
+	delete(h.clients[c.userID], c)
+	if len(h.clients[c.userID]) == 0 {
+		delete(h.clients, c.userID)
+	}
+	metrics.GatewayConnections.Dec()
+}
+
+// Subscribe adds the client to the topic. It returns false when the client
+// already has max_subscriptions topics.
+func (h *Hub) Subscribe(c *Client, topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c.closed {
+		return true // The connection is going away anyway
+	}
+	if _, ok := c.topics[topic]; ok {
+		return true
+	}
+	if len(c.topics) >= h.cfg.MaxSubscriptions {
+		return false
+	}
+	c.topics[topic] = struct{}{}
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]struct{})
+	}
+	h.topics[topic][c] = struct{}{}
+	return true
+}
+
+func (h *Hub) Unsubscribe(c *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribe(c, topic)
+}
+
+func (h *Hub) unsubscribe(c *Client, topic string) {
+	delete(c.topics, topic)
+	delete(h.topics[topic], c)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// Subscribed reports whether the client is subscribed to the topic.
+func (h *Hub) Subscribed(c *Client, topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// Active reports whether anyone is subscribed to the topic, so publishers can
+// skip building events nobody receives.
+func (h *Hub) Active(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[topic]) > 0
+}
+
+// Idle reports whether no client is connected.
+func (h *Hub) Idle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) == 0
+}
+
+// Publish sends the event to the subscribers of the topics but except. It
+// never blocks, clients that cannot keep up are disconnected.
+func (h *Hub) Publish(event Event, except *Client, topics ...string) error {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		for c := range h.topics[topic] {
+			if c != except {
+				h.send(c, frame, event.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Kick sends the event to the user's clients subscribed to the topic and
+// unsubscribes them, for users who lost access to it.
+func (h *Hub) Kick(topic string, userID int, event Event) error {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.topics[topic] {
+		if c.userID != userID {
+			continue
+		}
+		h.unsubscribe(c, topic)
+		h.send(c, frame, event.Type)
+	}
+	return nil
+}
+
+func (h *Hub) send(c *Client, frame []byte, eventType string) {
+	select {
+	case c.ch <- frame:
+		metrics.GatewayEventsTotal.WithLabelValues(eventType).Inc()
+	default:
+		c.lagged = true
+		h.disconnect(c)
+		metrics.GatewayLaggedTotal.Inc()
+	}
+}
+
+// Close disconnects every client, for the server to shut down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, clients := range h.clients {
+		for c := range clients {
+			h.disconnect(c)
+		}
+	}
+}
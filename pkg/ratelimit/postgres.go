@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type bucketRow struct {
+	Key       string    `gorm:"primaryKey"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null;index;autoUpdateTime:false"`
+}
+
+func (bucketRow) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// PostgresStore shares buckets between all instances through the database.
+type PostgresStore struct {
+	db        *gorm.DB
+	lastSweep atomic.Int64
+}
+
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&bucketRow{}); err != nil {
+		return nil, err
+	}
+	s := &PostgresStore{db: db}
+	s.lastSweep.Store(time.Now().Unix())
+	return s, nil
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	var result Result
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Database clock, instances may drift
+		var now time.Time
+		if err := tx.Raw("SELECT now()").Scan(&now).Error; err != nil {
+			return err
+		}
+
+		// CreateBucket
+		row := bucketRow{Key: key, Tokens: policy.burst(), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return err
+		}
+
+		// LockBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		// TakeToken
+		var tokens float64
+		tokens, result = take(row.Tokens, row.UpdatedAt, now, policy)
+		return tx.Model(&bucketRow{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"tokens":     tokens,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.sweep(ctx)
+	return result, nil
+}
+
+// sweep deletes buckets untouched for a day, at most once per sweepInterval across calls.
+func (s *PostgresStore) sweep(ctx context.Context) {
+	last := s.lastSweep.Load()
+	now := time.Now()
+	if now.Sub(time.Unix(last, 0)) < sweepInterval || !s.lastSweep.CompareAndSwap(last, now.Unix()) {
+		return
+	}
+	s.db.WithContext(ctx).Where("updated_at < ?", now.Add(-24*time.Hour)).Delete(&bucketRow{})
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+	"x-clone/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// Policy is a token bucket refilled with Requests tokens every Period and
+// holding at most Burst tokens.
+type Policy struct {
+	Name     string
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Period.Seconds()
+}
+
+func (p Policy) burst() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Requests)
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next token, when not allowed
+}
+
+// Store takes a token from the bucket identified by key.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// refill returns the tokens in a bucket last updated at updatedAt.
+func refill(tokens float64, updatedAt, now time.Time, policy Policy) float64 {
+	elapsed := now.Sub(updatedAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(policy.burst(), tokens+elapsed*policy.rate())
+}
+
+// take applies the token bucket algorithm to a bucket last updated at updatedAt.
+func take(tokens float64, updatedAt, now time.Time, policy Policy) (float64, Result) {
+	rate, burst := policy.rate(), policy.burst()
+	tokens = refill(tokens, updatedAt, now, policy)
+
+	result := Result{Limit: int(burst)}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((burst - tokens) / rate)
+
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+const (
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+// Limiter resolves named policies from the configuration against a Store.
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+func New(cfg *config.Config, db *gorm.DB) (*Limiter, error) {
+	if !cfg.RateLimit.Enabled {
+		return nil, nil
+	}
+
+	var store Store
+	switch cfg.RateLimit.Backend {
+	case BackendMemory, "":
+		store = NewMemoryStore()
+	case BackendPostgres:
+		pgStore, err := NewPostgresStore(db)
+		if err != nil {
+			return nil, err
+		}
+		store = pgStore
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimit.Backend)
+	}
+
+	policies := make(map[string]Policy, len(cfg.RateLimit.Policies))
+	for name, p := range cfg.RateLimit.Policies {
+		if p.Requests <= 0 || p.Period <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: requests and period must be positive", name)
+		}
+		policies[name] = Policy{Name: name, Requests: p.Requests, Period: p.Period, Burst: p.Burst}
+	}
+
+	return &Limiter{store: store, policies: policies}, nil
+}
+
+func (l *Limiter) Policy(name string) (Policy, bool) {
+	p, ok := l.policies[name]
+	return p, ok
+}
+
+func (l *Limiter) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	return l.store.Take(ctx, policy.Name+":"+key, policy)
+}
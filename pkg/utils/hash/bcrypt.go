@@ -0,0 +1,43 @@
+package hash
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const defaultBcryptCost = 12
+
+// bcryptHasher only looks at the first 72 bytes of a password, GenerateFromPassword
+// rejects longer ones instead of truncating them silently.
+type bcryptHasher struct {
+	cost int
+}
+
+func (bcryptHasher) algorithm() string {
+	return AlgorithmBcrypt
+}
+
+func (h bcryptHasher) validate() error {
+	if h.cost < bcrypt.MinCost || h.cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+func (h bcryptHasher) hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) verify(password, encoded string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+}
+
+func (h bcryptHasher) outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
@@ -2,18 +2,118 @@ package hash
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"x-clone/internal/config"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
 
-	"golang.org/x/crypto/bcrypt"
+// hasher produces and verifies one encoded hash format.
+type hasher interface {
+	algorithm() string
+	hash(password string) (string, error)
+	verify(password, encoded string) bool
+	// outdated reports whether encoded was produced with other parameters.
+	outdated(encoded string) bool
+}
+
+var (
+	current   hasher = bcryptHasher{cost: defaultBcryptCost}
+	currentMu sync.RWMutex
 )
 
+// Init selects the algorithm and parameters for new hashes. Existing hashes of
+// either algorithm keep verifying.
+func Init(cfg *config.Config) error {
+	params := cfg.PasswordHashing
+
+	var h hasher
+	switch params.Algorithm {
+	case AlgorithmArgon2id, "":
+		argon := argon2idHasher{
+			memory:      params.Argon2id.Memory,
+			iterations:  params.Argon2id.Iterations,
+			parallelism: params.Argon2id.Parallelism,
+		}
+		if argon.memory < 8*uint32(argon.parallelism) || argon.iterations < 1 || argon.parallelism < 1 {
+			return errors.New("invalid argon2id parameters")
+		}
+		h = argon
+	case AlgorithmBcrypt:
+		bc := bcryptHasher{cost: params.BcryptCost}
+		if err := bc.validate(); err != nil {
+			return err
+		}
+		h = bc
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", params.Algorithm)
+	}
+
+	currentMu.Lock()
+	current = h
+	currentMu.Unlock()
+	return nil
+}
+
+func currentHasher() hasher {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return current
+}
+
+// detect picks the hasher for a stored hash from its prefix.
+func detect(encoded string) (hasher, bool) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return argon2idHasher{}, true
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return bcryptHasher{}, true
+	default:
+		return nil, false
+	}
+}
+
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := currentHasher().hash(password)
 	if err != nil {
 		return "", errors.New("failed to hash password")
 	}
-	return string(hash), nil
+	return hash, nil
 }
 
 func CheckPassword(password, hash string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	h, ok := detect(hash)
+	if !ok {
+		return false
+	}
+	return h.verify(password, hash)
+}
+
+// NeedsRehash reports whether hash should be replaced after a successful
+// login because the algorithm or its parameters have changed.
+func NeedsRehash(hash string) bool {
+	h := currentHasher()
+	if stored, ok := detect(hash); !ok || stored.algorithm() != h.algorithm() {
+		return true
+	}
+	return h.outdated(hash)
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// CheckDummyPassword burns the same time as CheckPassword for a missing user,
+// so response timing does not reveal whether a username exists.
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = currentHasher().hash("dummy-password")
+	})
+	CheckPassword(password, dummyHash)
 }
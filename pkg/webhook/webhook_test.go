@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"ping"}`)
+
+	mac := hmac.New(sha256.New, []byte("whsec_secret"))
+	mac.Write([]byte(`1700000000.{"event":"ping"}`))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("whsec_secret", timestamp, body); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+	if Sign("whsec_other", timestamp, body) == want {
+		t.Error("Sign() ignores the secret")
+	}
+	if Sign("whsec_secret", timestamp.Add(time.Second), body) == want {
+		t.Error("Sign() ignores the timestamp")
+	}
+}
+
+func TestNewClientRejectsPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(time.Second, false).Get(srv.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("Get(%s) error = %v, want %v", srv.URL, err, ErrPrivateAddress)
+	}
+
+	resp, err := NewClient(time.Second, true).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get(%s) with private networks allowed: %v", srv.URL, err)
+	}
+	resp.Body.Close()
+}
+
+func TestIsPublic(t *testing.T) {
+	for _, test := range []struct {
+		ip     string
+		public bool
+	}{
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"192.168.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.100.100.200", false},
+		{"198.18.0.1", false},
+		{"192.0.0.8", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"64:ff9b::a00:1", false},
+		{"::ffff:10.0.0.1", false},
+		{"100.128.0.1", true},
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+	} {
+		if got := isPublic(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("isPublic(%s) = %v, want %v", test.ip, got, test.public)
+		}
+	}
+}